@@ -0,0 +1,286 @@
+// detect.go
+
+package repomap
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// filenameLanguages maps conventional file names without an extension to
+// the language they are written in. Names of languages without a registered
+// grammar are still recognised, so that their files are skipped.
+var filenameLanguages = map[string]string{
+	"makefile":    "make",
+	"gnumakefile": "make",
+	"jenkinsfile": "groovy",
+	"gemfile":     "ruby",
+	"rakefile":    "ruby",
+	"podfile":     "ruby",
+	"vagrantfile": "ruby",
+	"brewfile":    "ruby",
+}
+
+var (
+	// vim: set ft=python: and vim: filetype=ruby
+	vimModeline = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex)(?:[<=>]?\d+)?:(?:.*?[\s:])?(?:ft|filetype|syntax)=([\w+-]+)`)
+	// -*- mode: python -*- and -*- ruby -*-
+	emacsModeline = regexp.MustCompile(`-\*-(.+?)-\*-`)
+)
+
+// modelineLines is how many lines at each end of a file may hold a modeline,
+// as in vim.
+const modelineLines = 5
+
+// attributeRule is a line of a .gitattributes file setting or unsetting
+// `linguist-language` for the files matching its pattern.
+type attributeRule struct {
+	// dir is the directory of the .gitattributes file
+	dir     string
+	pattern *regexp.Regexp
+	// basename patterns match the file name at any depth below dir
+	basename bool
+	// language is empty when the rule unsets the attribute
+	language string
+}
+
+// languageDetector picks the language of a file from, in order of
+// precedence, `linguist-language` overrides in .gitattributes, editor
+// modelines, conventional file names, the extension and the shebang line.
+type languageDetector struct {
+	// rules are ordered so that later rules take precedence
+	rules []attributeRule
+}
+
+// newLanguageDetector returns a detector applying the .gitattributes files
+// in attributes, keyed by path.
+func newLanguageDetector(attributes map[string][]byte) *languageDetector {
+	paths := make([]string, 0, len(attributes))
+	for p := range attributes {
+		paths = append(paths, p)
+	}
+	// Files deeper in the tree override those above them
+	sort.Slice(paths, func(i, j int) bool {
+		di := strings.Count(filepath.ToSlash(paths[i]), "/")
+		dj := strings.Count(filepath.ToSlash(paths[j]), "/")
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+
+	d := &languageDetector{}
+	for _, p := range paths {
+		d.rules = append(d.rules, parseGitattributes(filepath.Dir(p), attributes[p])...)
+	}
+	return d
+}
+
+// newDiskLanguageDetector returns a detector applying the .gitattributes
+// files found on disk in the directories holding path, up to the root of
+// its repository.
+func newDiskLanguageDetector(path string) *languageDetector {
+	attributes := make(map[string][]byte)
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return &languageDetector{}
+	}
+	for {
+		p := filepath.Join(dir, ".gitattributes")
+		if content, err := os.ReadFile(p); err == nil {
+			attributes[p] = content
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return newLanguageDetector(attributes)
+}
+
+// parseGitattributes returns the `linguist-language` rules of a
+// .gitattributes file in dir.
+func parseGitattributes(dir string, content []byte) []attributeRule {
+	var rules []attributeRule
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		for _, attr := range fields[1:] {
+			var language string
+			switch {
+			case strings.HasPrefix(attr, "linguist-language="):
+				language = strings.TrimPrefix(attr, "linguist-language=")
+			case attr == "-linguist-language" || attr == "!linguist-language":
+			default:
+				continue
+			}
+
+			pattern := strings.TrimSuffix(fields[0], "/")
+			basename := !strings.Contains(pattern, "/")
+			pattern = strings.TrimPrefix(pattern, "/")
+			re, err := regexp.Compile(globRegexp(pattern))
+			if err != nil {
+				continue
+			}
+			rules = append(rules, attributeRule{dir, re, basename, language})
+		}
+	}
+	return rules
+}
+
+// globRegexp translates a gitattributes pattern into a regular expression.
+func globRegexp(pattern string) string {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				re.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(pattern[i:], ']'); end > 0 {
+				class := pattern[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + class + "]")
+				i += end
+			} else {
+				re.WriteString(`\[`)
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// linguistLanguage returns the `linguist-language` set for the file at p
+// and whether any rule applies to it.
+func (d *languageDetector) linguistLanguage(p string) (string, bool) {
+	var language string
+	found := false
+	for _, rule := range d.rules {
+		rel, err := filepath.Rel(rule.dir, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if rule.basename {
+			rel = path.Base(rel)
+		}
+		if rule.pattern.MatchString(rel) {
+			language, found = rule.language, rule.language != ""
+		}
+	}
+	return language, found
+}
+
+// detect returns the language of the file at p, or nil if it cannot be
+// classified or is written in a language without a registered grammar.
+func (d *languageDetector) detect(p string, content []byte) *language {
+	if name, ok := d.linguistLanguage(p); ok {
+		return languageFor(name)
+	}
+	if name := modelineLanguage(content); name != "" {
+		return languageFor(name)
+	}
+	if lang := languageForPath(p); lang != nil {
+		return lang
+	}
+	if name, ok := filenameLanguages[strings.ToLower(filepath.Base(p))]; ok {
+		return languageFor(name)
+	}
+	if name := shebangLanguage(content); name != "" {
+		return languageFor(name)
+	}
+	return nil
+}
+
+// modelineLanguage returns the language named by a vim or Emacs modeline in
+// the first or last lines of content.
+func modelineLanguage(content []byte) string {
+	// Find the end of the leading lines and the start of the trailing ones
+	// without splitting the whole file
+	head := 0
+	for i := 0; i < modelineLines && head < len(content); i++ {
+		if next := bytes.IndexByte(content[head:], '\n'); next >= 0 {
+			head += next + 1
+		} else {
+			head = len(content)
+		}
+	}
+	tail := len(content)
+	for i := 0; i < modelineLines && tail > head; i++ {
+		tail = bytes.LastIndexByte(content[head:tail-1], '\n') + head + 1
+	}
+
+	lines := bytes.Split(content[:head], []byte("\n"))
+	lines = append(lines, bytes.Split(content[tail:], []byte("\n"))...)
+	for _, line := range lines {
+		if m := vimModeline.FindSubmatch(line); m != nil {
+			return string(m[1])
+		}
+		if m := emacsModeline.FindSubmatch(line); m != nil {
+			inner := string(m[1])
+			if !strings.Contains(inner, ":") {
+				return strings.TrimSpace(inner)
+			}
+			for _, setting := range strings.Split(inner, ";") {
+				key, value, ok := strings.Cut(setting, ":")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "mode") {
+					return strings.TrimSpace(value)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// shebangLanguage returns the interpreter named by the shebang line of
+// content, without its version: python for `#!/usr/bin/env python3.12`.
+func shebangLanguage(content []byte) string {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return ""
+	}
+	line, _, _ := bytes.Cut(content[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// Skip the options and variable assignments of env
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+	return strings.TrimRight(interpreter, "0123456789.")
+}
@@ -5,6 +5,7 @@ package repomap
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type RepoMapError struct {
@@ -42,3 +43,40 @@ func NewTreeGenerationError(msg string) *RepoMapError {
 func NewFileSystemError(err error) *RepoMapError {
 	return &RepoMapError{Err: fmt.Errorf("filesystem error: %w", err)}
 }
+
+// QueryError reports an invalid tags query: the file it was loaded from, if
+// any, the position of the error and the capture of the failing pattern.
+type QueryError struct {
+	File     string
+	Language string
+	Line     int
+	Column   int
+	Capture  string
+	Err      error
+}
+
+func (e *QueryError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", e.Line, e.Column)
+		}
+		b.WriteString(": ")
+	}
+	if e.Language != "" {
+		fmt.Fprintf(&b, "%s query: ", e.Language)
+	}
+	if e.File == "" && e.Line > 0 {
+		fmt.Fprintf(&b, "line %d column %d: ", e.Line, e.Column)
+	}
+	if e.Capture != "" {
+		fmt.Fprintf(&b, "@%s: ", e.Capture)
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,74 @@
+// grammar_library.go
+
+//go:build cgo && unix
+
+package repomap
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+typedef const void *(*language_func)(void);
+
+static const void *call_language(void *fn) {
+	return ((language_func)fn)();
+}
+
+// The ABI version is the first field of every TSLanguage
+static uint32_t language_version(const void *language) {
+	return *(const uint32_t *)language;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	tree_sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Language ABI versions supported by the bundled tree-sitter runtime
+const (
+	minGrammarVersion = 13
+	maxGrammarVersion = 14
+)
+
+// LoadGrammar loads the compiled tree-sitter grammar in the shared library
+// at path, as built by `tree-sitter build` or a C compiler, and returns the
+// language exported as `tree_sitter_<name>`. The library stays loaded for
+// the lifetime of the process.
+func LoadGrammar(path, name string) (*tree_sitter.Language, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	handle := C.dlopen(cPath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("failed to load grammar %s: %s", path, C.GoString(C.dlerror()))
+	}
+
+	symbol := "tree_sitter_" + strings.ReplaceAll(name, "-", "_")
+	cSymbol := C.CString(symbol)
+	defer C.free(unsafe.Pointer(cSymbol))
+
+	fn := C.dlsym(handle, cSymbol)
+	if fn == nil {
+		C.dlclose(handle)
+		return nil, fmt.Errorf("grammar %s does not export %s", path, symbol)
+	}
+
+	ptr := C.call_language(fn)
+	if ptr == nil {
+		C.dlclose(handle)
+		return nil, fmt.Errorf("grammar %s returned no language", path)
+	}
+	if version := C.language_version(ptr); version < minGrammarVersion || version > maxGrammarVersion {
+		C.dlclose(handle)
+		return nil, fmt.Errorf("grammar %s has ABI version %d, want %d to %d", path, version, minGrammarVersion, maxGrammarVersion)
+	}
+
+	return tree_sitter.NewLanguage(unsafe.Pointer(ptr)), nil
+}
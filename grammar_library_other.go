@@ -0,0 +1,17 @@
+// grammar_library_other.go
+
+//go:build !cgo || !unix
+
+package repomap
+
+import (
+	"fmt"
+
+	tree_sitter "github.com/smacker/go-tree-sitter"
+)
+
+// LoadGrammar loads a compiled tree-sitter grammar from a shared library,
+// which this platform does not support.
+func LoadGrammar(path, name string) (*tree_sitter.Language, error) {
+	return nil, fmt.Errorf("failed to load grammar %s: shared libraries are not supported on this platform", path)
+}
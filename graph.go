@@ -59,6 +59,10 @@ func (g *DiGraph) NumEdges() int {
 	return count
 }
 
+// fileEdgeWeight is the weight of an explicit file-to-file edge, matching
+// the multiplier given to mentioned identifiers.
+const fileEdgeWeight = 10.0
+
 type RankedDefinition struct {
 	Key   NodeIndex
 	Value float64
@@ -104,6 +108,17 @@ func (tg *TagGraph) PopulateFromTagIndex(tagIndex *TagIndex, mentionedIdents map
 		tg.getOrCreateNode(path)
 	}
 
+	// Explicit file edges, such as includes, count as much as a mentioned
+	// identifier
+	for from, targets := range tagIndex.FileEdges {
+		for to := range targets {
+			fromIdx := tg.getOrCreateNode(from)
+			toIdx := tg.getOrCreateNode(to)
+			edgeIndex := tg.graph.AddEdge(fromIdx, toIdx, fileEdgeWeight)
+			tg.edgeToIdent[edgeIndex] = to
+		}
+	}
+
 	// Then create edges based on references
 	for ident := range tagIndex.CommonTags {
 		mul := tg.calculateMultiplier(ident, mentionedIdents)
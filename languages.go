@@ -0,0 +1,323 @@
+// languages.go
+
+package repomap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tree_sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/bash"
+	"github.com/smacker/go-tree-sitter/c"
+	"github.com/smacker/go-tree-sitter/cpp"
+	"github.com/smacker/go-tree-sitter/csharp"
+	"github.com/smacker/go-tree-sitter/css"
+	"github.com/smacker/go-tree-sitter/dockerfile"
+	"github.com/smacker/go-tree-sitter/elixir"
+	"github.com/smacker/go-tree-sitter/elm"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/groovy"
+	"github.com/smacker/go-tree-sitter/hcl"
+	"github.com/smacker/go-tree-sitter/html"
+	"github.com/smacker/go-tree-sitter/java"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/kotlin"
+	markdown "github.com/smacker/go-tree-sitter/markdown/tree-sitter-markdown"
+	markdown_inline "github.com/smacker/go-tree-sitter/markdown/tree-sitter-markdown-inline"
+	"github.com/smacker/go-tree-sitter/ocaml"
+	"github.com/smacker/go-tree-sitter/php"
+	"github.com/smacker/go-tree-sitter/protobuf"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/ruby"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/scala"
+	"github.com/smacker/go-tree-sitter/sql"
+	"github.com/smacker/go-tree-sitter/svelte"
+	"github.com/smacker/go-tree-sitter/swift"
+	"github.com/smacker/go-tree-sitter/toml"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+	"github.com/smacker/go-tree-sitter/yaml"
+)
+
+// language is a grammar registered for tag extraction and rendering.
+// Registered languages are never modified, only replaced.
+type language struct {
+	name       string
+	extensions []string
+	filenames  []string
+	grammar    *tree_sitter.Language
+	// query holds the tag patterns; a language without one is only rendered
+	query  string
+	scopes *scopeSpec
+	// resolver picks the file resolver of a GenerateFromFiles run
+	resolver func(e *extractor) fileResolver
+	namer    nameFunc
+	// filePackage derives the package of a file from its path, for
+	// languages whose files do not declare it
+	filePackage func(relPath string) string
+	// moduleName qualifies the names that are only visible within the
+	// module of the file at relPath, where they are defined and referenced
+	moduleName func(relPath, name string) string
+	// splitType reports whether a definition of the given symbol kind may be
+	// one part of a type declared across several files, such as a C#
+	// partial class
+	splitType func(node *tree_sitter.Node, kind string) bool
+}
+
+// languageRegistry indexes the registered languages by name, extension and
+// file name.
+type languageRegistry struct {
+	mu         sync.RWMutex
+	byName     map[string]*language
+	byExt      map[string]*language
+	byFilename map[string]*language
+}
+
+var languages = &languageRegistry{
+	byName:     make(map[string]*language),
+	byExt:      make(map[string]*language),
+	byFilename: make(map[string]*language),
+}
+
+// RegisterLanguage makes a tree-sitter grammar available under name for the
+// given file extensions (without the dot) and file names, which may be glob
+// patterns such as "Dockerfile.*". The tags query captures definitions as
+// `@def.<kind>` or `@definition.<kind>` and references as `@ref.<kind>` or
+// `@reference.<kind>`, named by their own text or by a `@name` capture of
+// the same pattern. Patterns may filter their matches with the `#eq?`,
+// `#match?` and `#any-of?` predicates and their `not-` and `any-` variants,
+// and set the symbol kind of their tags with `(#set! kind "...")`. Of the
+// patterns tagging the same node, the first one sets its kind. An invalid
+// query is reported as a *QueryError.
+//
+// Registering a bundled language's name, or one of its aliases such as
+// golang or shell, again overrides its grammar, query or files; a nil
+// grammar or list keeps the bundled one, less the files other languages
+// have claimed since, and the scoping and import resolution of the bundled
+// language are kept.
+func RegisterLanguage(name string, extensions, filenames []string, grammar *tree_sitter.Language, tagsQuery string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return errors.New("language name is empty")
+	}
+	// Aliases are resolved before lookups, so they cannot name a language
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+
+	languages.mu.Lock()
+	defer languages.mu.Unlock()
+
+	lang := &language{name: name}
+	if old, ok := languages.byName[name]; ok {
+		*lang = *old
+	}
+	if grammar != nil {
+		lang.grammar = grammar
+	}
+	if lang.grammar == nil {
+		return fmt.Errorf("language %s has no grammar", name)
+	}
+	if tagsQuery != "" {
+		query, qerr := compileQuery(lang.grammar, tagsQuery, 0)
+		if qerr != nil {
+			qerr.Language = name
+			return qerr
+		}
+		query.Close()
+		lang.query = tagsQuery
+	}
+	// Kept lists lose the entries other languages have claimed since
+	if extensions != nil {
+		lang.extensions = extensions
+	} else {
+		lang.extensions = owned(name, lang.extensions, languages.byExt, extensionKey)
+	}
+	if filenames != nil {
+		lang.filenames = filenames
+	} else {
+		lang.filenames = owned(name, lang.filenames, languages.byFilename, strings.ToLower)
+	}
+
+	languages.add(lang)
+	return nil
+}
+
+// RegisterLanguageLibrary loads the grammar exported as `tree_sitter_<name>`
+// by the shared library at libraryPath and registers it like
+// RegisterLanguage, with the tags query read from queryPath. This lets a
+// grammar be added without rebuilding the program using this package.
+func RegisterLanguageLibrary(name, libraryPath, queryPath string, extensions, filenames []string) error {
+	grammar, err := LoadGrammar(libraryPath, name)
+	if err != nil {
+		return err
+	}
+
+	var source []byte
+	if queryPath != "" {
+		source, err = os.ReadFile(queryPath)
+		if err != nil {
+			return &QueryError{File: queryPath, Language: name, Err: err}
+		}
+		query, qerr := compileQuery(grammar, string(source), 0)
+		if qerr != nil {
+			qerr.File = queryPath
+			qerr.Language = name
+			return qerr
+		}
+		query.Close()
+	}
+
+	return RegisterLanguage(name, extensions, filenames, grammar, string(source))
+}
+
+// add registers lang, taking over its extensions and file names from any
+// language that claimed them before.
+func (r *languageRegistry) add(lang *language) {
+	for key, other := range r.byExt {
+		if other.name == lang.name {
+			delete(r.byExt, key)
+		}
+	}
+	for key, other := range r.byFilename {
+		if other.name == lang.name {
+			delete(r.byFilename, key)
+		}
+	}
+
+	r.byName[lang.name] = lang
+	for _, ext := range lang.extensions {
+		r.byExt[extensionKey(ext)] = lang
+	}
+	for _, filename := range lang.filenames {
+		r.byFilename[strings.ToLower(filename)] = lang
+	}
+}
+
+// owned returns the entries of list that index, keyed by key, still maps to
+// the language called name.
+func owned(name string, list []string, index map[string]*language, key func(string) string) []string {
+	var kept []string
+	for _, entry := range list {
+		if lang, ok := index[key(entry)]; ok && lang.name == name {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// extensionKey returns the registry key of a file extension.
+func extensionKey(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// languageFor returns the language registered under name, one of its
+// aliases or, as code fences often name them, one of its extensions.
+func languageFor(name string) *language {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+
+	languages.mu.RLock()
+	defer languages.mu.RUnlock()
+
+	if lang, ok := languages.byName[name]; ok {
+		return lang
+	}
+	return languages.byExt[name]
+}
+
+// languageForPath returns the language of the file at path, matched by its
+// base name first and its extension otherwise, or nil if none is registered.
+func languageForPath(path string) *language {
+	base := strings.ToLower(filepath.Base(path))
+
+	languages.mu.RLock()
+	defer languages.mu.RUnlock()
+
+	if lang, ok := languages.byFilename[base]; ok {
+		return lang
+	}
+	for pattern, lang := range languages.byFilename {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return lang
+		}
+	}
+	return languages.byExt[strings.TrimPrefix(filepath.Ext(base), ".")]
+}
+
+// languageAliases maps the language names used by Markdown code fences,
+// notebook metadata, modelines, shebang interpreters and .gitattributes to
+// registered language names.
+var languageAliases = map[string]string{
+	"golang":          "go",
+	"python3":         "python",
+	"c#":              "csharp",
+	"c++":             "cpp",
+	"shell":           "bash",
+	"shell-script":    "bash",
+	"zsh":             "bash",
+	"dash":            "bash",
+	"ksh":             "bash",
+	"ash":             "bash",
+	"docker":          "dockerfile",
+	"terraform":       "hcl",
+	"protocol-buffer": "protobuf",
+	"js2":             "javascript",
+	"node":            "javascript",
+	"nodejs":          "javascript",
+	"bun":             "javascript",
+	"javascriptreact": "javascript",
+	"typescriptreact": "tsx",
+	"deno":            "typescript",
+	"ts-node":         "typescript",
+}
+
+func init() {
+	modules := func(e *extractor) fileResolver { return e.modules }
+	static := func(resolver fileResolver) func(*extractor) fileResolver {
+		return func(*extractor) fileResolver { return resolver }
+	}
+
+	for _, lang := range []*language{
+		{name: "bash", extensions: []string{"sh", "bash"}, grammar: bash.GetLanguage(), query: bashQuery, resolver: static(resolveSource)},
+		{name: "c", extensions: []string{"c"}, grammar: c.GetLanguage(), query: cQuery, resolver: static(resolveInclude)},
+		{name: "cpp", extensions: []string{"cpp", "cc", "cxx", "h", "hh", "hpp"}, grammar: cpp.GetLanguage(), query: cppQuery, scopes: cppScopes, resolver: static(resolveInclude), splitType: cppSplitType},
+		{name: "csharp", extensions: []string{"cs"}, grammar: csharp.GetLanguage(), query: csharpQuery, scopes: csharpScopes, splitType: csharpSplitType},
+		{name: "css", extensions: []string{"css"}, grammar: css.GetLanguage(), query: cssQuery, namer: selectorNames},
+		{name: "dockerfile", extensions: []string{"dockerfile"}, filenames: []string{"Dockerfile", "Dockerfile.*"}, grammar: dockerfile.GetLanguage(), query: dockerfileQuery, resolver: static(resolveCopySource), namer: dockerfileName},
+		{name: "elixir", extensions: []string{"ex", "exs"}, grammar: elixir.GetLanguage(), query: elixirQuery, scopes: elixirScopes},
+		{name: "elm", extensions: []string{"elm"}, grammar: elm.GetLanguage(), query: elmQuery},
+		{name: "go", extensions: []string{"go"}, grammar: golang.GetLanguage(), query: goQuery, scopes: goScopes, resolver: func(e *extractor) fileResolver { return e.goPackages }, filePackage: goPackageDir},
+		{name: "groovy", extensions: []string{"groovy", "gradle"}, grammar: groovy.GetLanguage(), query: groovyQuery, scopes: groovyScopes},
+		{name: "hcl", extensions: []string{"hcl", "tf"}, grammar: hcl.GetLanguage(), query: hclQuery, resolver: static(resolveModuleSource), namer: hclAddress, moduleName: hclModuleName},
+		{name: "html", extensions: []string{"html"}, grammar: html.GetLanguage(), query: htmlQuery, namer: selectorNames},
+		{name: "java", extensions: []string{"java"}, grammar: java.GetLanguage(), query: javaQuery, scopes: javaScopes},
+		{name: "javascript", extensions: []string{"js", "jsx", "mjs", "cjs"}, grammar: javascript.GetLanguage(), query: jsxQuery, resolver: modules, namer: selectorNames},
+		{name: "kotlin", extensions: []string{"kt"}, grammar: kotlin.GetLanguage(), query: kotlinQuery, scopes: kotlinScopes},
+		{name: "markdown", extensions: []string{"md", "markdown"}, grammar: markdown.GetLanguage(), query: markdownQuery},
+		{name: "markdown_inline", grammar: markdown_inline.GetLanguage(), query: markdownInlineQuery},
+		{name: "ocaml", extensions: []string{"ml"}, grammar: ocaml.GetLanguage(), query: ocamlQuery, scopes: ocamlScopes, filePackage: ocamlModule},
+		{name: "php", extensions: []string{"php"}, grammar: php.GetLanguage(), query: phpQuery, scopes: phpScopes, resolver: func(e *extractor) fileResolver { return e.psr4 }},
+		{name: "protobuf", extensions: []string{"proto"}, grammar: protobuf.GetLanguage(), query: protoQuery, scopes: protoScopes, resolver: static(resolveInclude)},
+		{name: "python", extensions: []string{"py"}, grammar: python.GetLanguage(), query: pythonQuery},
+		{name: "ruby", extensions: []string{"rb"}, grammar: ruby.GetLanguage(), query: rubyQuery, scopes: rubyScopes, resolver: static(resolveRequire), namer: rubyName},
+		{name: "rust", extensions: []string{"rs"}, grammar: rust.GetLanguage(), query: rustQuery, scopes: rustScopes, splitType: rustSplitType},
+		{name: "scala", extensions: []string{"scala"}, grammar: scala.GetLanguage(), query: scalaQuery, scopes: scalaScopes},
+		{name: "sql", extensions: []string{"sql"}, grammar: sql.GetLanguage(), query: sqlQuery},
+		{name: "svelte", extensions: []string{"svelte"}, grammar: svelte.GetLanguage(), query: htmlQuery, namer: selectorNames},
+		{name: "swift", extensions: []string{"swift"}, grammar: swift.GetLanguage(), query: swiftQuery, scopes: swiftScopes},
+		{name: "toml", extensions: []string{"toml"}, grammar: toml.GetLanguage()},
+		{name: "tsx", extensions: []string{"tsx"}, grammar: tsx.GetLanguage(), query: tsxQuery, resolver: modules, namer: selectorNames},
+		{name: "typescript", extensions: []string{"ts", "mts", "cts"}, grammar: typescript.GetLanguage(), query: typescriptQuery, resolver: modules},
+		{name: "yaml", extensions: []string{"yaml", "yml"}, grammar: yaml.GetLanguage(), query: yamlQuery, namer: yamlName},
+	} {
+		languages.add(lang)
+	}
+}
@@ -0,0 +1,171 @@
+// notebook.go
+
+package repomap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// notebookCell is a cell of a Jupyter notebook together with the host line
+// of each element of its source.
+type notebookCell struct {
+	cellType string
+	source   []string
+	lines    []int
+}
+
+// extractNotebook tags the code cells of a Jupyter notebook. The cells are
+// joined into one program in the kernel's language and the tags found in it
+// are moved back to the notebook lines holding their source.
+func (e *extractor) extractNotebook(ctx context.Context, path string, content []byte) ([]Tag, error) {
+	cells, language, err := parseNotebook(content)
+	if err != nil {
+		// Like any other unparseable data file, a broken notebook is skipped
+		return nil, nil
+	}
+
+	if language == "" {
+		language = "python"
+	}
+	lang := languageFor(language)
+	if lang == nil {
+		return nil, nil
+	}
+
+	// Each program line maps to the notebook line it came from
+	var program strings.Builder
+	var lines []int
+	partial := false
+	for _, cell := range cells {
+		if cell.cellType != "code" {
+			continue
+		}
+		for i, source := range cell.source {
+			for _, piece := range strings.SplitAfter(source, "\n") {
+				if piece == "" {
+					continue
+				}
+				if !partial {
+					lines = append(lines, cell.lines[i])
+				}
+				program.WriteString(piece)
+				partial = !strings.HasSuffix(piece, "\n")
+			}
+		}
+		if partial {
+			program.WriteString("\n")
+			partial = false
+		}
+	}
+
+	tags, err := e.extract(ctx, path, lang, []byte(program.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tags {
+		if row := tags[i].Line - 1; row >= 0 && row < len(lines) {
+			tags[i].Line = lines[row]
+		}
+	}
+	return tags, nil
+}
+
+// parseNotebook returns the cells of a notebook and the language of its
+// kernel. Source lines are located by walking the JSON tokens, since the
+// decoded cells no longer know where they were.
+func parseNotebook(content []byte) ([]notebookCell, string, error) {
+	var cells []notebookCell
+	var kernelLanguage, infoLanguage string
+
+	cell := func(index string) *notebookCell {
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			return nil
+		}
+		for len(cells) <= i {
+			cells = append(cells, notebookCell{})
+		}
+		return &cells[i]
+	}
+
+	// Offsets only grow, so lines are counted incrementally
+	var lastOffset int64
+	line := 1
+	lineAt := func(offset int64) int {
+		line += bytes.Count(content[lastOffset:offset], []byte("\n"))
+		lastOffset = offset
+		return line
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	err := walkJSON(dec, nil, func(path []string, value json.Token, offset int64) {
+		text, ok := value.(string)
+		if !ok {
+			return
+		}
+		switch {
+		case len(path) == 3 && path[0] == "cells" && path[2] == "cell_type":
+			if c := cell(path[1]); c != nil {
+				c.cellType = text
+			}
+		case len(path) >= 3 && path[0] == "cells" && path[2] == "source":
+			if c := cell(path[1]); c != nil {
+				c.source = append(c.source, text)
+				c.lines = append(c.lines, lineAt(offset))
+			}
+		case len(path) == 3 && path[0] == "metadata" && path[1] == "kernelspec" && path[2] == "language":
+			kernelLanguage = text
+		case len(path) == 3 && path[0] == "metadata" && path[1] == "language_info" && path[2] == "name":
+			infoLanguage = text
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if kernelLanguage != "" {
+		return cells, kernelLanguage, nil
+	}
+	return cells, infoLanguage, nil
+}
+
+// walkJSON calls visit with the path, value and end offset of every scalar
+// in the next JSON value read from dec. Array elements are named by index.
+func walkJSON(dec *json.Decoder, path []string, visit func(path []string, value json.Token, offset int64)) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			name, _ := key.(string)
+			if err := walkJSON(dec, append(path[:len(path):len(path)], name), visit); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := walkJSON(dec, append(path[:len(path):len(path)], strconv.Itoa(i)), visit); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+
+	visit(path, token, dec.InputOffset())
+	return nil
+}
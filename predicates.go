@@ -0,0 +1,217 @@
+// predicates.go
+
+package repomap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	tree_sitter "github.com/smacker/go-tree-sitter"
+)
+
+// tagsQuery is a compiled tags query together with the predicates and
+// properties of each of its patterns, indexed by pattern.
+type tagsQuery struct {
+	*tree_sitter.Query
+	patterns []patternPredicates
+}
+
+// patternPredicates holds the text predicates a match of one pattern must
+// satisfy and the properties its `#set!` directives attach to it.
+type patternPredicates struct {
+	predicates []predicate
+	properties map[string]string
+}
+
+// predicate is one `#eq?`, `#match?` or `#any-of?` predicate, or one of
+// their `not-` and `any-` variants.
+type predicate struct {
+	operator string
+	// negated predicates hold for the texts that fail the test
+	negated bool
+	// quantified `any-` predicates need one node of the capture to pass
+	// rather than all of them
+	quantified bool
+	capture    string
+	// other is the capture compared by `#eq? @a @b`
+	other  string
+	values []string
+	regex  *regexp.Regexp
+}
+
+// predicateError reports an invalid predicate of a query.
+type predicateError struct {
+	capture string
+	near    string
+	err     error
+}
+
+// compilePredicates prepares the predicates and directives of every pattern
+// of query. Directives other than `#set!` are ignored, as they only shape
+// the captured text in other tools.
+func compilePredicates(query *tree_sitter.Query) ([]patternPredicates, *predicateError) {
+	patterns := make([]patternPredicates, query.PatternCount())
+	for i := range patterns {
+		pattern := &patterns[i]
+		for _, steps := range query.PredicatesForPattern(uint32(i)) {
+			// Each predicate ends with a done step
+			if last := len(steps) - 1; steps[last].Type == tree_sitter.QueryPredicateStepTypeDone {
+				steps = steps[:last]
+			}
+			name := query.StringValueForId(steps[0].ValueId)
+			args := steps[1:]
+
+			if strings.HasSuffix(name, "!") {
+				if name == "set!" {
+					pattern.set(query, args)
+				}
+				continue
+			}
+
+			p, err := newPredicate(query, name, args)
+			if err != nil {
+				return nil, err
+			}
+			pattern.predicates = append(pattern.predicates, p)
+		}
+	}
+	return patterns, nil
+}
+
+// newPredicate parses the predicate called name with the given arguments.
+func newPredicate(query *tree_sitter.Query, name string, args []tree_sitter.QueryPredicateStep) (predicate, *predicateError) {
+	var p predicate
+	near := "#" + name
+	if len(args) == 0 || args[0].Type != tree_sitter.QueryPredicateStepTypeCapture {
+		return p, &predicateError{near: near, err: fmt.Errorf("#%s needs a capture as first argument", name)}
+	}
+	p.capture = query.CaptureNameForId(args[0].ValueId)
+	near += " @" + p.capture
+
+	op := strings.TrimSuffix(name, "?")
+	if op == "not-any-of" {
+		p.negated = true
+		op = "any-of"
+	}
+	if op != "any-of" {
+		if rest, ok := strings.CutPrefix(op, "any-"); ok {
+			p.quantified = true
+			op = rest
+		}
+		if rest, ok := strings.CutPrefix(op, "not-"); ok {
+			p.negated = true
+			op = rest
+		}
+	}
+	p.operator = op
+
+	for _, arg := range args[1:] {
+		if arg.Type == tree_sitter.QueryPredicateStepTypeCapture {
+			if op != "eq" || p.other != "" || len(args) != 2 {
+				return p, &predicateError{p.capture, near, fmt.Errorf("#%s takes strings only after its capture", name)}
+			}
+			p.other = query.CaptureNameForId(arg.ValueId)
+			continue
+		}
+		p.values = append(p.values, query.StringValueForId(arg.ValueId))
+	}
+
+	switch op {
+	case "eq":
+		if p.other == "" && len(p.values) != 1 {
+			return p, &predicateError{p.capture, near, fmt.Errorf("#%s takes a capture and a value", name)}
+		}
+	case "match":
+		if len(p.values) != 1 {
+			return p, &predicateError{p.capture, near, fmt.Errorf("#%s takes a capture and a pattern", name)}
+		}
+		re, err := regexp.Compile(p.values[0])
+		if err != nil {
+			return p, &predicateError{p.capture, near, err}
+		}
+		p.regex = re
+	case "any-of":
+		if len(p.values) == 0 {
+			return p, &predicateError{p.capture, near, fmt.Errorf("#%s takes a capture and values", name)}
+		}
+	default:
+		return p, &predicateError{p.capture, near, fmt.Errorf("unsupported predicate #%s", name)}
+	}
+	return p, nil
+}
+
+// set records a `(#set! key value)` directive; tree-sitter only accepts
+// string arguments to it.
+func (pattern *patternPredicates) set(query *tree_sitter.Query, args []tree_sitter.QueryPredicateStep) {
+	if len(args) == 0 {
+		return
+	}
+	key := query.StringValueForId(args[0].ValueId)
+	var value string
+	if len(args) > 1 {
+		value = query.StringValueForId(args[1].ValueId)
+	}
+
+	if pattern.properties == nil {
+		pattern.properties = make(map[string]string)
+	}
+	pattern.properties[key] = value
+}
+
+// matches reports whether match satisfies the predicates of its pattern.
+func (pattern *patternPredicates) matches(query *tree_sitter.Query, match *tree_sitter.QueryMatch, content []byte) bool {
+	if len(pattern.predicates) == 0 {
+		return true
+	}
+
+	// Quantified captures hold several nodes
+	texts := make(map[string][]string)
+	for _, capture := range match.Captures {
+		name := query.CaptureNameForId(capture.Index)
+		texts[name] = append(texts[name], capture.Node.Content(content))
+	}
+
+	for _, p := range pattern.predicates {
+		if !p.holds(texts) {
+			return false
+		}
+	}
+	return true
+}
+
+// holds evaluates p against the texts of the captures of a match. Like in
+// tree-sitter, a predicate on a capture without nodes holds unless it is
+// quantified.
+func (p *predicate) holds(texts map[string][]string) bool {
+	nodes := texts[p.capture]
+	others := texts[p.other]
+
+	for i, text := range nodes {
+		var ok bool
+		switch {
+		case p.other != "":
+			ok = i < len(others) && text == others[i]
+		case p.operator == "eq":
+			ok = text == p.values[0]
+		case p.operator == "match":
+			ok = p.regex.MatchString(text)
+		case p.operator == "any-of":
+			for _, value := range p.values {
+				if text == value {
+					ok = true
+					break
+				}
+			}
+		}
+
+		if ok != p.negated {
+			if p.quantified {
+				return true
+			}
+		} else if !p.quantified {
+			return false
+		}
+	}
+	return !p.quantified
+}
@@ -0,0 +1,540 @@
+// queries.go
+
+package repomap
+
+// Query patterns for different languages
+const (
+	goQuery = `
+		(function_declaration 
+			name: (identifier) @def.function)
+		(method_declaration 
+			name: (field_identifier) @def.method)
+		(type_declaration 
+			(type_spec 
+				name: (type_identifier) @def.type))
+		(source_file
+			(const_declaration
+				(const_spec
+					(identifier) @def.constant)))
+		(source_file
+			(var_declaration
+				(var_spec
+					(identifier) @def.variable)))
+		(source_file
+			(var_declaration
+				(var_spec_list
+					(var_spec
+						(identifier) @def.variable))))
+		(field_declaration
+			name: (field_identifier) @def.field)
+		(method_elem
+			name: (field_identifier) @def.method)
+		(import_spec
+			path: (interpreted_string_literal) @ref.import)
+		(import_spec
+			path: (interpreted_string_literal) @file.import)
+		(identifier) @ref.ident
+		(field_identifier) @ref.field
+	`
+	jsQuery = `
+		(function_declaration 
+			name: (identifier) @def.function)
+		(generator_function_declaration
+			name: (identifier) @def.function)
+		(method_definition 
+			name: (property_identifier) @def.method)
+		(class_declaration 
+			name: (_) @def.class)
+		(program
+			(lexical_declaration
+				(variable_declarator
+					name: (identifier) @def.function
+					value: [(arrow_function) (function_expression)])))
+		(export_statement
+			declaration: (lexical_declaration
+				(variable_declarator
+					name: (identifier) @def.function
+					value: [(arrow_function) (function_expression)])))
+		(export_statement
+			declaration: (lexical_declaration
+				(variable_declarator
+					name: (identifier) @def.variable)))
+		(import_statement
+			source: (string (string_fragment) @file.import))
+		(export_statement
+			source: (string (string_fragment) @file.import))
+		((call_expression
+			function: (identifier) @_require
+			arguments: (arguments . (string (string_fragment) @file.import)))
+			(#eq? @_require "require"))
+		(call_expression
+			function: (import)
+			arguments: (arguments . (string (string_fragment) @file.import)))
+		(identifier) @ref.ident
+		(property_identifier) @ref.prop
+	`
+	typescriptQuery = jsQuery + `
+		(interface_declaration
+			name: (type_identifier) @def.interface)
+		(type_alias_declaration
+			name: (type_identifier) @def.type)
+		(enum_declaration
+			name: (identifier) @def.enum)
+		(abstract_class_declaration
+			name: (type_identifier) @def.class)
+		(method_signature
+			name: (property_identifier) @def.method)
+		(type_identifier) @ref.type
+	`
+	pythonQuery = `
+		(module
+			(expression_statement
+				(assignment
+					left: (identifier) @def.variable)))
+		(module
+			(expression_statement
+				(assignment
+					left: (pattern_list (identifier) @def.variable))))
+		(class_definition
+			name: (identifier) @def.class)
+		(module
+			(function_definition
+				name: (identifier) @def.function))
+		(module
+			(decorated_definition
+				definition: (function_definition
+					name: (identifier) @def.function)))
+		(class_definition
+			body: (block
+				(function_definition
+					name: (identifier) @def.method)))
+		(class_definition
+			body: (block
+				(decorated_definition
+					definition: (function_definition
+						name: (identifier) @def.method))))
+		(class_definition
+			superclasses: (argument_list (identifier) @ref.class))
+		(call
+			function: (identifier) @ref.call)
+		(attribute
+			attribute: (identifier) @ref.attribute)
+		(import_statement
+			name: (dotted_name (identifier) @ref.import))
+		(import_statement
+			name: (aliased_import
+				name: (dotted_name (identifier) @ref.import)))
+		(import_from_statement
+			module_name: (dotted_name (identifier) @ref.module))
+		(import_from_statement
+			name: (dotted_name (identifier) @ref.import))
+		(import_from_statement
+			name: (aliased_import
+				name: (dotted_name (identifier) @ref.import)))
+	`
+	rustQuery = `
+		(struct_item name: (type_identifier) @def.struct)
+		(enum_item name: (type_identifier) @def.enum)
+		(union_item name: (type_identifier) @def.union)
+		(type_item name: (type_identifier) @def.type)
+		(trait_item name: (type_identifier) @def.trait)
+		(function_item name: (identifier) @def.function)
+		(function_signature_item name: (identifier) @def.function)
+		(mod_item name: (identifier) @def.module)
+		(macro_definition name: (identifier) @def.macro)
+		(const_item name: (identifier) @def.constant)
+		(static_item name: (identifier) @def.constant)
+		(impl_item trait: (type_identifier) @ref.implementation)
+		(impl_item trait: (scoped_type_identifier name: (type_identifier) @ref.implementation))
+		(impl_item type: (type_identifier) @ref.implementation)
+		(impl_item type: (generic_type type: (type_identifier) @ref.implementation))
+		(use_declaration argument: (identifier) @ref.import)
+		(use_declaration argument: (scoped_identifier) @ref.import)
+		(use_declaration argument: (use_as_clause path: (_) @ref.import))
+		(scoped_use_list path: (_) @ref.module)
+		(use_list (identifier) @ref.import)
+		(use_list (scoped_identifier) @ref.import)
+		(use_list (use_as_clause path: (_) @ref.import))
+		(call_expression function: (identifier) @ref.call)
+		(call_expression function: (scoped_identifier path: [(identifier) (scoped_identifier)]) @ref.call)
+		(call_expression function: (scoped_identifier path: (generic_type) name: (identifier) @ref.call))
+		(call_expression function: (field_expression field: (field_identifier) @ref.call))
+		(macro_invocation macro: (identifier) @ref.macro)
+		(type_identifier) @ref.type
+	`
+	javaQuery = `
+		(package_declaration [(identifier) (scoped_identifier)] @package.name)
+		(class_declaration name: (identifier) @def.class)
+		(interface_declaration name: (identifier) @def.interface)
+		(enum_declaration name: (identifier) @def.enum)
+		(record_declaration name: (identifier) @def.record)
+		(annotation_type_declaration name: (identifier) @def.annotation)
+		(method_declaration name: (identifier) @def.method)
+		(constructor_declaration name: (identifier) @def.constructor)
+		(field_declaration declarator: (variable_declarator name: (identifier) @def.field))
+		(import_declaration [(identifier) (scoped_identifier)] @ref.import)
+		(method_invocation name: (identifier) @ref.call)
+		(marker_annotation name: (identifier) @ref.annotation)
+		(annotation name: (identifier) @ref.annotation)
+		(type_identifier) @ref.type
+	`
+	kotlinQuery = `
+		(package_header (identifier) @package.name)
+		(class_declaration (type_identifier) @def.class)
+		(object_declaration (type_identifier) @def.object)
+		(type_alias (type_identifier) @def.type)
+		(function_declaration (simple_identifier) @def.function)
+		(secondary_constructor "constructor" @def.constructor)
+		(source_file (property_declaration (variable_declaration (simple_identifier) @def.property)))
+		(class_body (property_declaration (variable_declaration (simple_identifier) @def.property)))
+		(class_parameter (binding_pattern_kind) (simple_identifier) @def.property)
+		(import_header (identifier) @ref.import)
+		(call_expression (simple_identifier) @ref.call)
+		(navigation_suffix (simple_identifier) @ref.member)
+		(user_type (type_identifier) @ref.type)
+	`
+	cQuery = `
+		(function_definition declarator: (function_declarator declarator: (identifier) @def.function))
+		(function_definition declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @def.function)))
+		(declaration declarator: (function_declarator declarator: (identifier) @def.function))
+		(declaration declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @def.function)))
+		(struct_specifier name: (type_identifier) @def.struct body: (_))
+		(union_specifier name: (type_identifier) @def.union body: (_))
+		(enum_specifier name: (type_identifier) @def.enum body: (_))
+		(type_definition declarator: (type_identifier) @def.type)
+		(preproc_def name: (identifier) @def.macro)
+		(preproc_function_def name: (identifier) @def.macro)
+		(preproc_include path: (string_literal (string_content) @file.include))
+		(call_expression function: (identifier) @ref.call)
+		(call_expression function: (field_expression field: (field_identifier) @ref.call))
+		(type_identifier) @ref.type
+	`
+	cppQuery = `
+		(function_definition declarator: (function_declarator declarator: [(identifier) (field_identifier) (qualified_identifier)] @def.function))
+		(function_definition declarator: (pointer_declarator declarator: (function_declarator declarator: [(identifier) (qualified_identifier)] @def.function)))
+		(function_definition declarator: (reference_declarator (function_declarator declarator: [(identifier) (qualified_identifier)] @def.function)))
+		(declaration declarator: (function_declarator declarator: [(identifier) (qualified_identifier)] @def.function))
+		(declaration declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @def.function)))
+		(field_declaration declarator: (function_declarator declarator: (field_identifier) @def.method))
+		(class_specifier name: (type_identifier) @def.class body: (_))
+		(struct_specifier name: (type_identifier) @def.struct body: (_))
+		(union_specifier name: (type_identifier) @def.union body: (_))
+		(enum_specifier name: (type_identifier) @def.enum body: (_))
+		(namespace_definition name: (namespace_identifier) @def.namespace)
+		(type_definition declarator: (type_identifier) @def.type)
+		(alias_declaration name: (type_identifier) @def.type)
+		(preproc_def name: (identifier) @def.macro)
+		(preproc_function_def name: (identifier) @def.macro)
+		(preproc_include path: (string_literal (string_content) @file.include))
+		(call_expression function: (identifier) @ref.call)
+		(call_expression function: (qualified_identifier) @ref.call)
+		(call_expression function: (field_expression field: (field_identifier) @ref.call))
+		(type_identifier) @ref.type
+	`
+	csharpQuery = `
+		(file_scoped_namespace_declaration name: (_) @package.name)
+		(namespace_declaration name: (_) @def.namespace)
+		(class_declaration name: (identifier) @def.class)
+		(interface_declaration name: (identifier) @def.interface)
+		(struct_declaration name: (identifier) @def.struct)
+		(record_declaration name: (identifier) @def.record)
+		(enum_declaration name: (identifier) @def.enum)
+		(method_declaration name: (identifier) @def.method)
+		(constructor_declaration name: (identifier) @def.constructor)
+		(property_declaration name: (identifier) @def.property)
+		(field_declaration (variable_declaration (variable_declarator name: (identifier) @def.field)))
+		(using_directive [(identifier) (qualified_name)] @ref.import .)
+		(base_list (identifier) @ref.type)
+		(base_list (generic_name (identifier) @ref.type))
+		(variable_declaration type: (identifier) @ref.type)
+		(parameter type: (identifier) @ref.type)
+		(property_declaration type: (identifier) @ref.type)
+		(method_declaration returns: (identifier) @ref.type)
+		(object_creation_expression type: (identifier) @ref.type)
+		(generic_name (identifier) @ref.type)
+		(invocation_expression function: (identifier) @ref.call)
+		(invocation_expression function: (member_access_expression name: (identifier) @ref.call))
+	`
+	phpQuery = `
+		(namespace_definition name: (namespace_name) @package.name)
+		(class_declaration name: (name) @def.class)
+		(interface_declaration name: (name) @def.interface)
+		(trait_declaration name: (name) @def.trait)
+		(enum_declaration name: (name) @def.enum)
+		(function_definition name: (name) @def.function)
+		(method_declaration name: (name) @def.method)
+		(const_declaration (const_element (name) @def.constant))
+		(property_declaration (property_element (variable_name (name) @def.property)))
+		(namespace_use_clause (qualified_name) @ref.import @file.use)
+		(namespace_use_clause (name) @ref.import)
+		(namespace_use_declaration (namespace_name) @ref.module)
+		(namespace_use_group_clause (namespace_name) @ref.import)
+		(base_clause [(name) (qualified_name)] @ref.type)
+		(class_interface_clause [(name) (qualified_name)] @ref.type)
+		(use_declaration [(name) (qualified_name)] @ref.trait)
+		(named_type [(name) (qualified_name)] @ref.type)
+		(object_creation_expression [(name) (qualified_name)] @ref.type)
+		(function_call_expression function: [(name) (qualified_name)] @ref.call)
+		(member_call_expression name: (name) @ref.call)
+		(scoped_call_expression scope: [(name) (qualified_name)] @ref.type)
+		(scoped_call_expression name: (name) @ref.call)
+	`
+	rubyQuery = `
+		(module name: [(constant) (scope_resolution)] @def.module)
+		(class name: [(constant) (scope_resolution)] @def.class)
+		(method name: (_) @def.method)
+		(singleton_method name: (_) @def.method)
+		(assignment left: (constant) @def.constant)
+		((call
+			method: (identifier) @_attr
+			arguments: (argument_list (simple_symbol) @def.accessor))
+			(#match? @_attr "^attr_(reader|writer|accessor)$"))
+		((call
+			method: (identifier) @_require
+			arguments: (argument_list (string (string_content) @file.require)))
+			(#match? @_require "^require(_relative)?$"))
+		(call method: (identifier) @ref.call)
+		(superclass (constant) @ref.class)
+		(scope_resolution) @ref.constant
+		(constant) @ref.constant
+	`
+	swiftQuery = `
+		(class_declaration name: (type_identifier) @def.class)
+		(protocol_declaration name: (type_identifier) @def.interface)
+		(typealias_declaration name: (type_identifier) @def.type)
+		(function_declaration name: (simple_identifier) @def.function)
+		(protocol_function_declaration name: (simple_identifier) @def.function)
+		(class_body (property_declaration name: (pattern bound_identifier: (simple_identifier) @def.property)))
+		(source_file (property_declaration name: (pattern bound_identifier: (simple_identifier) @def.property)))
+		(import_declaration (identifier) @ref.import)
+		(inheritance_specifier inherits_from: (user_type (type_identifier) @ref.type))
+		(class_declaration name: (user_type (type_identifier) @ref.extension))
+		(user_type (type_identifier) @ref.type)
+		(call_expression (simple_identifier) @ref.call)
+		(navigation_suffix suffix: (simple_identifier) @ref.member)
+	`
+	scalaQuery = `
+		(package_clause name: (package_identifier) @package.name)
+		(class_definition name: (identifier) @def.class)
+		(object_definition name: (identifier) @def.object)
+		(trait_definition name: (identifier) @def.trait)
+		(enum_definition name: (identifier) @def.enum)
+		(type_definition name: (type_identifier) @def.type)
+		(function_definition name: (identifier) @def.function)
+		(function_declaration name: (identifier) @def.function)
+		(template_body (val_definition pattern: (identifier) @def.value))
+		(compilation_unit (val_definition pattern: (identifier) @def.value))
+		(import_declaration (identifier) @ref.import .)
+		(namespace_selectors (identifier) @ref.import)
+		(extends_clause type: (type_identifier) @ref.type)
+		(type_identifier) @ref.type
+		(call_expression function: (identifier) @ref.call)
+		(call_expression function: (field_expression field: (identifier) @ref.call))
+		(field_expression value: (identifier) @ref.object)
+	`
+	groovyQuery = `
+		(groovy_package (qualified_name) @package.name)
+		(class_definition name: (identifier) @def.class)
+		(function_definition function: (identifier) @def.function)
+		(function_declaration function: (identifier) @def.function)
+		(class_definition body: (closure (declaration name: (identifier) @def.property)))
+		((juxt_function_call
+			function: (identifier) @_task
+			args: (argument_list [(identifier) @def.task (function_call function: (identifier) @def.task)]))
+			(#eq? @_task "task"))
+		((declaration type: (identifier) @_task name: (identifier) @def.task)
+			(#eq? @_task "task"))
+		(groovy_import import: (qualified_name) @ref.import)
+		(class_definition superclass: (identifier) @ref.type)
+		((declaration type: (identifier) @ref.type)
+			(#not-eq? @ref.type "task"))
+		(function_call function: (identifier) @ref.call)
+		(function_call function: (dotted_identifier (identifier) @ref.call .))
+		((juxt_function_call function: (identifier) @ref.call)
+			(#not-eq? @ref.call "task"))
+		((juxt_function_call
+			function: (identifier) @_depends
+			args: (argument_list (string (string_content) @ref.task)))
+			(#eq? @_depends "dependsOn"))
+	`
+	elixirQuery = `
+		((call
+			target: (identifier) @_keyword
+			(arguments (alias) @def.module))
+			(#eq? @_keyword "defmodule"))
+		((call
+			target: (identifier) @_keyword
+			(arguments [
+				(identifier) @def.function
+				(call target: (identifier) @def.function)
+				(binary_operator left: (call target: (identifier) @def.function))
+			]))
+			(#match? @_keyword "^(def|defp|defmacro|defmacrop|defguard|defguardp|defdelegate)$"))
+		((call target: (identifier) @ref.call)
+			(#not-match? @ref.call "^(def|defp|defmacro|defmacrop|defguard|defguardp|defdelegate|defmodule|defstruct|alias|import|use|require)$"))
+		(call target: (dot right: (identifier)) @ref.call)
+		(alias) @ref.module
+	`
+	ocamlQuery = `
+		(module_binding name: (module_name) @def.module)
+		(module_type_definition name: (module_type_name) @def.interface)
+		(compilation_unit (value_definition (let_binding pattern: (value_name) @def.function)))
+		(structure (value_definition (let_binding pattern: (value_name) @def.function)))
+		(type_binding name: (type_constructor) @def.type)
+		(value_specification (value_name) @def.function)
+		(open_module (module_path) @ref.module)
+		(module_path (module_name) @ref.module)
+		(value_path) @ref.call
+		(type_constructor_path (type_constructor) @ref.type)
+	`
+	elmQuery = `
+		(module_declaration name: (upper_case_qid) @package.module)
+		(type_alias_declaration name: (upper_case_identifier) @def.type)
+		(type_declaration name: (upper_case_identifier) @def.type)
+		(union_variant name: (upper_case_identifier) @def.constructor)
+		(file (value_declaration (function_declaration_left . (lower_case_identifier) @def.function)))
+		(import_clause moduleName: (upper_case_qid) @ref.module)
+		(import_clause exposing: (exposing_list (exposed_value (lower_case_identifier) @ref.import)))
+		(import_clause exposing: (exposing_list (exposed_type (upper_case_identifier) @ref.import)))
+		(value_qid (lower_case_identifier) @ref.call .)
+		(type_ref (upper_case_qid) @ref.type)
+	`
+	bashQuery = `
+		(function_definition name: (word) @def.function)
+		((command
+			name: (command_name) @_source
+			argument: [
+				(word) @file.source
+				(raw_string) @file.source
+				(string . (string_content) @file.source .)
+			])
+			(#match? @_source "^(source|\\.)$"))
+		((command name: (command_name (word) @ref.call))
+			(#not-match? @ref.call "^(source|\\.)$"))
+	`
+	sqlQuery = `
+		(create_table (object_reference name: (identifier) @def.table))
+		(create_view (object_reference name: (identifier) @def.view))
+		(create_materialized_view (object_reference name: (identifier) @def.view))
+		(create_function (object_reference name: (identifier) @def.function))
+		(create_type (object_reference name: (identifier) @def.type))
+		(create_index column: (identifier) @def.index)
+		(create_trigger (keyword_trigger) . (object_reference name: (identifier) @def.trigger))
+		(create_index (object_reference name: (identifier) @ref.table))
+		(create_trigger (keyword_on) . (object_reference name: (identifier) @ref.table))
+		(create_trigger (keyword_function) . (object_reference name: (identifier) @ref.call))
+		(column_definition (object_reference name: (identifier) @ref.table))
+		(constraint (object_reference name: (identifier) @ref.table))
+		(relation (object_reference name: (identifier) @ref.table))
+		(from (object_reference name: (identifier) @ref.table))
+		(insert (object_reference name: (identifier) @ref.table))
+		(invocation (object_reference name: (identifier) @ref.call))
+	`
+	protoQuery = `
+		(package (full_ident) @package.name)
+		(message (message_name (identifier) @def.message))
+		(enum (enum_name (identifier) @def.enum))
+		(service (service_name (identifier) @def.service))
+		(rpc (rpc_name (identifier) @def.rpc))
+		(import path: (string) @file.import)
+		(message_or_enum_type) @ref.type
+	`
+	hclQuery = `
+		((block (identifier) @def.resource . (string_lit))
+			(#eq? @def.resource "resource"))
+		((block (identifier) @def.data . (string_lit))
+			(#eq? @def.data "data"))
+		((block (identifier) @def.module . (string_lit))
+			(#eq? @def.module "module"))
+		((block (identifier) @def.variable . (string_lit))
+			(#eq? @def.variable "variable"))
+		((block (identifier) @def.output . (string_lit))
+			(#eq? @def.output "output"))
+		((block (identifier) @_locals (body (attribute (identifier) @def.local)))
+			(#eq? @_locals "locals"))
+		((block
+			(identifier) @_module
+			(body (attribute
+				(identifier) @_source
+				(expression (literal_value (string_lit (template_literal) @file.module))))))
+			(#eq? @_module "module")
+			(#eq? @_source "source"))
+		((variable_expr (identifier) @ref.address)
+			(#not-match? @ref.address "^(each|count|path|self|terraform)$"))
+	`
+	dockerfileQuery = `
+		(from_instruction as: (image_alias) @def.stage)
+		(from_instruction (image_spec name: (image_name) @ref.image))
+		((copy_instruction (param) @ref.stage)
+			(#match? @ref.stage "^--from="))
+		((copy_instruction (param)* @_param (path) @file.copy . (path))
+			(#not-match? @_param "^--from="))
+		(add_instruction (path) @file.copy . (path))
+	`
+	yamlQuery = `
+		(document (block_node (block_mapping (block_mapping_pair key: (flow_node) @def.key))))
+		((document (block_node (block_mapping (block_mapping_pair
+			key: (flow_node) @_metadata
+			value: (block_node (block_mapping (block_mapping_pair
+				key: (flow_node) @_name
+				value: (flow_node) @def.resource)))))))
+			(#eq? @_metadata "metadata")
+			(#eq? @_name "name"))
+		((document (block_node (block_mapping (block_mapping_pair
+			key: (flow_node) @_services
+			value: (block_node (block_mapping (block_mapping_pair key: (flow_node) @def.service)))))))
+			(#eq? @_services "services"))
+		((block_mapping_pair
+			key: (flow_node) @_depends
+			value: [
+				(block_node (block_sequence (block_sequence_item (flow_node) @ref.service)))
+				(block_node (block_mapping (block_mapping_pair key: (flow_node) @ref.service)))
+				(flow_node (flow_sequence (flow_node) @ref.service))
+			])
+			(#eq? @_depends "depends_on"))
+		((block_mapping_pair
+			key: (flow_node) @_ref
+			value: (block_node (block_mapping (block_mapping_pair
+				key: (flow_node) @_name
+				value: (flow_node) @ref.resource))))
+			(#match? @_ref "^(configMapRef|configMapKeyRef|configMap|secretRef|secretKeyRef|service)$")
+			(#eq? @_name "name"))
+		((block_mapping_pair key: (flow_node) @_ref value: (flow_node) @ref.resource)
+			(#match? @_ref "^(serviceName|secretName|claimName)$"))
+		((block_mapping_pair key: (flow_node) @_image value: (flow_node) @ref.image)
+			(#eq? @_image "image"))
+	`
+	jsxAttributeQuery = `
+		((jsx_attribute (property_identifier) @_attr (string (string_fragment) @ref.selector))
+			(#match? @_attr "^(className|class|id)$"))
+	`
+	jsxQuery = jsQuery + jsxAttributeQuery
+	tsxQuery = typescriptQuery + jsxAttributeQuery
+	cssQuery = `
+		(class_selector (class_name) @def.selector)
+		(id_selector (id_name) @def.selector)
+	`
+	htmlQuery = `
+		((attribute
+			(attribute_name) @_attr
+			[(attribute_value) @ref.selector (quoted_attribute_value (attribute_value) @ref.selector)])
+			(#match? @_attr "^(class|id)$"))
+		((script_element (start_tag) @_tag (raw_text) @injection.ts)
+			(#match? @_tag "lang=[\"']?(ts|typescript)[\"' >]"))
+		((script_element (start_tag) @_tag (raw_text) @injection.js)
+			(#not-match? @_tag "lang=[\"']?(ts|typescript)[\"' >]"))
+		(style_element (raw_text) @injection.css)
+	`
+	markdownQuery = `
+		(atx_heading heading_content: (inline) @def.heading)
+		(setext_heading heading_content: (paragraph (inline) @def.heading))
+		(inline) @injection.markdown_inline
+		(fenced_code_block
+			(info_string (language) @injection.language)
+			(code_fence_content) @injection.content)
+	`
+	markdownInlineQuery = `
+		((code_span) @ref.code
+			(#match? @ref.code "^\\x60[A-Za-z_][A-Za-z0-9_.:]*\\x60$"))
+	`
+)
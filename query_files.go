@@ -0,0 +1,224 @@
+// query_files.go
+
+package repomap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tree_sitter "github.com/smacker/go-tree-sitter"
+)
+
+// captureKinds are the capture prefixes extraction understands. Besides this
+// package's `@def`/`@ref` captures they cover the `@definition.*`,
+// `@reference.*`, `@name` and `@doc` captures of tags.scm files.
+var captureKinds = map[string]bool{
+	"def":        true,
+	"ref":        true,
+	"definition": true,
+	"reference":  true,
+	"name":       true,
+	"doc":        true,
+	"local":      true,
+	"package":    true,
+	"file":       true,
+	"injection":  true,
+}
+
+// extendsModeline marks a query file that adds to the registered query
+// rather than replacing it.
+var extendsModeline = regexp.MustCompile(`^;+\s*extends\s*$`)
+
+// LoadQueryDir loads the tags queries found in dir and registers them for
+// their languages. A query is read from `<language>.scm`,
+// `<language>-tags.scm` or `<language>/tags.scm`, where the language may be
+// named by its registered name, an alias or an extension.
+//
+// A query file replaces the language's query, unless it starts with a
+// `; extends` comment, in which case its patterns are added to it. Files that
+// fail to load are reported as *QueryError values in the returned error and
+// leave their language untouched; the other files are loaded regardless.
+func LoadQueryDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return NewFileSystemError(err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		var name, path string
+		switch {
+		case entry.IsDir():
+			path = filepath.Join(dir, entry.Name(), "tags.scm")
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			name = entry.Name()
+		case filepath.Ext(entry.Name()) == ".scm":
+			path = filepath.Join(dir, entry.Name())
+			name = strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".scm"), "-tags")
+		default:
+			continue
+		}
+
+		if err := loadQueryFile(name, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadQueryFile registers the query in path for the language called name.
+func loadQueryFile(name, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return &QueryError{File: path, Language: name, Err: err}
+	}
+
+	lang := languageFor(name)
+	if lang == nil {
+		return &QueryError{File: path, Language: name, Err: errors.New("no registered language")}
+	}
+
+	source := string(content)
+	base := 0
+	if isExtension(source) && lang.query != "" {
+		base = len(lang.query) + 1
+		source = lang.query + "\n" + source
+	}
+
+	query, qerr := compileQuery(lang.grammar, source, base)
+	if qerr != nil {
+		qerr.File = path
+		qerr.Language = lang.name
+		return qerr
+	}
+	query.Close()
+
+	return RegisterLanguage(lang.name, nil, nil, nil, source)
+}
+
+// isExtension reports whether the leading comments of a query file hold the
+// `; extends` modeline.
+func isExtension(source string) bool {
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ";") {
+			return false
+		}
+		if extendsModeline.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileQuery compiles source for grammar together with its predicates,
+// and checks what the compiler does not: that every capture is one
+// extraction understands and that every predicate is supported and valid.
+// Positions in the returned error are counted from the byte offset base of
+// source, where the text of the query file starts.
+func compileQuery(grammar *tree_sitter.Language, source string, base int) (*tagsQuery, *QueryError) {
+	query, err := tree_sitter.NewQuery([]byte(source), grammar)
+	if err != nil {
+		qerr := &QueryError{Err: err}
+		var tsErr *tree_sitter.QueryError
+		if errors.As(err, &tsErr) {
+			offset := int(tsErr.Offset)
+			qerr.Line, qerr.Column = queryPosition(source, base, offset)
+			qerr.Capture = queryCaptureAt(source, offset)
+			if token := queryToken(source, offset); token != "" {
+				qerr.Err = fmt.Errorf("invalid %s %q", queryErrorType(tsErr.Type), token)
+			} else {
+				qerr.Err = fmt.Errorf("invalid %s", queryErrorType(tsErr.Type))
+			}
+		}
+		return nil, qerr
+	}
+
+	fail := func(capture, near string, err error) (*tagsQuery, *QueryError) {
+		query.Close()
+		qerr := &QueryError{Capture: capture, Err: err}
+		if offset := strings.Index(source[base:], near); offset >= 0 {
+			qerr.Line, qerr.Column = queryPosition(source, base, base+offset)
+		}
+		return nil, qerr
+	}
+
+	for i := uint32(0); i < query.CaptureCount(); i++ {
+		name := query.CaptureNameForId(i)
+		kind, _, dotted := strings.Cut(name, ".")
+		if dotted && !captureKinds[kind] {
+			return fail(name, "@"+name, fmt.Errorf("unknown capture kind %q", kind))
+		}
+	}
+
+	patterns, perr := compilePredicates(query)
+	if perr != nil {
+		return fail(perr.capture, perr.near, perr.err)
+	}
+
+	return &tagsQuery{query, patterns}, nil
+}
+
+// queryPosition returns the 1-based line and column of offset in the part
+// of source starting at base, or zeros if offset lies before it.
+func queryPosition(source string, base, offset int) (int, int) {
+	if offset < base || offset > len(source) {
+		return 0, 0
+	}
+	text := source[base:offset]
+	return strings.Count(text, "\n") + 1, len(text) - strings.LastIndex(text, "\n")
+}
+
+// queryCaptureAt returns the capture the query error at offset belongs to:
+// the capture under offset, or else the next one in source.
+func queryCaptureAt(source string, offset int) string {
+	if offset > len(source) {
+		return ""
+	}
+	start := offset
+	for start > 0 && isQueryIdentByte(source[start-1]) {
+		start--
+	}
+	if start > 0 && source[start-1] == '@' {
+		return queryToken(source, start)
+	}
+	if at := strings.IndexByte(source[offset:], '@'); at >= 0 {
+		return queryToken(source, offset+at+1)
+	}
+	return ""
+}
+
+// queryToken returns the node type, field or capture name at offset.
+func queryToken(source string, offset int) string {
+	end := offset
+	for end < len(source) && isQueryIdentByte(source[end]) {
+		end++
+	}
+	return source[offset:end]
+}
+
+func isQueryIdentByte(b byte) bool {
+	return b == '_' || b == '-' || b == '.' ||
+		'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// queryErrorType names the kind of a query compiler error.
+func queryErrorType(errorType tree_sitter.QueryErrorType) string {
+	switch errorType {
+	case tree_sitter.QueryErrorStructure:
+		return "structure"
+	case tree_sitter.QueryErrorLanguage:
+		return "language"
+	default:
+		return tree_sitter.QueryErrorTypeToString(errorType)
+	}
+}
@@ -2,12 +2,17 @@ package repomap
 
 import (
 	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
 	tree_sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/c"
+	"github.com/smacker/go-tree-sitter/python"
 )
 
 func TestRepoMap(t *testing.T) {
@@ -49,17 +54,17 @@ func TestRepoMap(t *testing.T) {
 
 	// Test definitions
 	expectedDefs := map[string]bool{
-		"main":           false,
-		"HandleUsers":    false,
-		"HandlePosts":    false,
-		"HandleHealth":   false,
-		"NewUserService": false,
-		"NewPostService": false,
-		"NewAuthService": false,
-		"User":           false,
-		"Post":           false,
-		"PostComment":    false,
-		"AuthMiddleware": false,
+		"main":                      false,
+		"handlers.HandleUsers":      false,
+		"handlers.HandlePosts":      false,
+		"handlers.HandleHealth":     false,
+		"services.NewUserService":   false,
+		"services.NewPostService":   false,
+		"services.NewAuthService":   false,
+		"models.User":               false,
+		"models.Post":               false,
+		"models.PostComment":        false,
+		"middleware.AuthMiddleware": false,
 	}
 
 	for key := range tagIndex.Defines {
@@ -130,7 +135,7 @@ func TestLanguageSupport(t *testing.T) {
 	}
 
 	for _, lang := range expectedLanguages {
-		if _, ok := tsLanguages[lang]; !ok {
+		if languageFor(lang) == nil {
 			t.Errorf("Expected support for %s language", lang)
 		}
 	}
@@ -144,27 +149,39 @@ func TestFileExtensionMapping(t *testing.T) {
 		{"test.go", "go"},
 		{"test.js", "js"},
 		{"test.ts", "ts"},
+		{"test.tsx", "tsx"},
+		{"test.jsx", "jsx"},
+		{"test.mjs", "mjs"},
+		{"test.cts", "cts"},
 		{"test.py", "py"},
 		{"test.java", "java"},
 		{"test.rb", "rb"},
 		{"test.rs", "rs"},
 		{"test.cpp", "cpp"},
+		{"test.cc", "cc"},
+		{"test.cxx", "cxx"},
+		{"test.h", "h"},
+		{"test.hh", "hh"},
+		{"test.hpp", "hpp"},
 		{"test.cs", "cs"},
 		{"test.php", "php"},
+		{"test.ex", "ex"},
+		{"test.exs", "exs"},
+		{"test.sh", "sh"},
+		{"test.tf", "tf"},
 	}
 
 	parser := tree_sitter.NewParser()
 
 	for _, tc := range testCases {
 		t.Run(tc.filename, func(t *testing.T) {
-			ext := strings.TrimPrefix(filepath.Ext(tc.filename), ".")
-			lang, ok := tsLanguages[ext]
-			if !ok {
-				t.Errorf("No language support for extension %s", ext)
+			lang := languageForPath(tc.filename)
+			if lang == nil {
+				t.Errorf("No language support for extension %s", tc.ext)
 				return
 			}
 
-			parser.SetLanguage(lang)
+			parser.SetLanguage(lang.grammar)
 			tree, err := parser.ParseCtx(context.Background(), nil, []byte("// Test file"))
 			if err != nil {
 				t.Errorf("Failed to parse %s: %v", tc.filename, err)
@@ -185,19 +202,1695 @@ func TestQueryParsing(t *testing.T) {
 	}{
 		{"Go", goQuery, "go"},
 		{"JavaScript", jsQuery, "javascript"},
+		{"TypeScript", typescriptQuery, "typescript"},
+		{"TSX", tsxQuery, "tsx"},
+		{"Python", pythonQuery, "python"},
+		{"Rust", rustQuery, "rust"},
+		{"Java", javaQuery, "java"},
+		{"Kotlin", kotlinQuery, "kotlin"},
+		{"C", cQuery, "c"},
+		{"C++", cppQuery, "cpp"},
+		{"C#", csharpQuery, "csharp"},
+		{"PHP", phpQuery, "php"},
+		{"Ruby", rubyQuery, "ruby"},
+		{"Swift", swiftQuery, "swift"},
+		{"Scala", scalaQuery, "scala"},
+		{"Groovy", groovyQuery, "groovy"},
+		{"Elixir", elixirQuery, "elixir"},
+		{"OCaml", ocamlQuery, "ocaml"},
+		{"Elm", elmQuery, "elm"},
+		{"Bash", bashQuery, "bash"},
+		{"SQL", sqlQuery, "sql"},
+		{"Protobuf", protoQuery, "proto"},
+		{"HCL", hclQuery, "hcl"},
+		{"Dockerfile", dockerfileQuery, "dockerfile"},
+		{"YAML", yamlQuery, "yaml"},
+		{"JSX", jsxQuery, "javascript"},
+		{"CSS", cssQuery, "css"},
+		{"HTML", htmlQuery, "html"},
+		{"Svelte", htmlQuery, "svelte"},
+		{"Markdown", markdownQuery, "markdown"},
+		{"MarkdownInline", markdownInlineQuery, "markdown_inline"},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			lang := tsLanguages[tc.lang]
+			lang := languageFor(tc.lang)
 			if lang == nil {
 				t.Fatalf("Language %s not supported", tc.lang)
 			}
 
-			_, err := tree_sitter.NewQuery([]byte(tc.query), lang)
+			_, err := tree_sitter.NewQuery([]byte(tc.query), lang.grammar)
 			if err != nil {
 				t.Errorf("Failed to parse query for %s: %v", tc.name, err)
 			}
 		})
 	}
 }
+
+// generateTags builds a TagIndex from in-memory sources keyed by relative path.
+func generateTags(t *testing.T, sources map[string]string) *TagIndex {
+	t.Helper()
+
+	files := make(map[string][]byte, len(sources))
+	for path, content := range sources {
+		files[path] = []byte(content)
+	}
+
+	tagIndex := NewTagIndex(".")
+	if err := tagIndex.GenerateFromFiles(context.Background(), files); err != nil {
+		t.Fatalf("Failed to generate tags: %v", err)
+	}
+	return tagIndex
+}
+
+func assertDefines(t *testing.T, tagIndex *TagIndex, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, ok := tagIndex.Defines[name]; !ok {
+			t.Errorf("Expected definition not found: %s", name)
+		}
+	}
+}
+
+func assertReferences(t *testing.T, tagIndex *TagIndex, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, ok := tagIndex.References[name]; !ok {
+			t.Errorf("Expected reference not found: %s", name)
+		}
+	}
+}
+
+func TestPythonTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"app/services.py": `
+import os
+from app.models import User
+
+DEFAULT_LIMIT = 10
+
+class UserService(Base):
+    def __init__(self):
+        self.repo = make_repo()
+
+    @property
+    def name(self):
+        return os.getenv("NAME")
+
+def make_repo():
+    return User()
+`,
+	})
+
+	assertDefines(t, tagIndex, "DEFAULT_LIMIT", "UserService", "__init__", "name", "make_repo")
+	assertReferences(t, tagIndex, "os", "models", "User", "Base", "make_repo", "getenv")
+}
+
+func TestRustTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"src/models.rs": `
+pub struct User { id: u32 }
+
+impl User {
+    pub fn new() -> Self { User { id: 0 } }
+}
+
+macro_rules! user { () => { User::new() } }
+`,
+		"src/store.rs": `
+use crate::models::User;
+
+pub mod cache {
+    pub struct Store;
+    impl Store {
+        pub fn new() -> Self { Store }
+    }
+}
+
+pub trait Repository { fn find(&self, id: u32) -> Option<User>; }
+
+impl Repository for cache::Store {
+    fn find(&self, id: u32) -> Option<User> { Some(User::new()) }
+}
+`,
+		"src/main.rs": `
+use crate::models::User;
+`,
+	})
+
+	assertDefines(t, tagIndex, "User", "User::new", "user", "cache", "cache::Store", "cache::Store::new", "Repository", "Repository::find")
+	if _, ok := tagIndex.Defines["new"]; ok {
+		t.Error("Expected methods to be qualified by their impl type")
+	}
+
+	assertReferences(t, tagIndex, "User::new", "Repository")
+	if refs := tagIndex.References["User"]; !contains(refs, "src/main.rs") {
+		t.Errorf("Expected use path to resolve to User, got %v", refs)
+	}
+}
+
+func TestJavaKotlinTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"src/com/acme/users/UserService.java": `
+package com.acme.users;
+
+public class UserService {
+    private final Cache cache;
+    public UserService() {}
+    public User get(String id) { return cache.lookup(id); }
+    static class Builder { UserService build() { return new UserService(); } }
+}
+`,
+		"src/com/acme/orders/OrderService.java": `
+package com.acme.orders;
+
+import com.acme.users.UserService;
+
+public interface OrderService {
+    Order get(String id);
+    UserService users();
+}
+`,
+		"src/com/acme/billing/Invoice.kt": `
+package com.acme.billing
+
+import com.acme.users.UserService
+
+data class Invoice(val id: String) {
+    constructor() : this("1")
+    fun get(): String = id
+}
+
+object Invoices { fun create(users: UserService) = Invoice("1") }
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"com.acme.users.UserService",
+		"com.acme.users.UserService.UserService",
+		"com.acme.users.UserService.get",
+		"com.acme.users.UserService.cache",
+		"com.acme.users.UserService.Builder.build",
+		"com.acme.orders.OrderService.get",
+		"com.acme.billing.Invoice",
+		"com.acme.billing.Invoice.id",
+		"com.acme.billing.Invoice.get",
+		"com.acme.billing.Invoice.constructor",
+		"com.acme.billing.Invoices.create",
+	)
+	if _, ok := tagIndex.Defines["get"]; ok {
+		t.Error("Expected methods to be qualified by package and class")
+	}
+
+	refs := tagIndex.References["com.acme.users.UserService"]
+	for _, path := range []string{"src/com/acme/orders/OrderService.java", "src/com/acme/billing/Invoice.kt"} {
+		if !contains(refs, path) {
+			t.Errorf("Expected %s to reference UserService by its qualified name, got %v", path, refs)
+		}
+	}
+}
+
+func TestCIncludeEdges(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"src/list.h": `
+typedef struct list { int len; } list_t;
+list_t *list_new(void);
+`,
+		"src/list.c": `
+#include "list.h"
+list_t *list_new(void) { return 0; }
+`,
+		"src/main.c": `
+#include "list.h"
+#include "util/log.h"
+#include <stdio.h>
+int main(void) { list_t *l = list_new(); log_info("%d", l->len); return 0; }
+`,
+		"include/util/log.h": `
+#define LOG_LEVEL 1
+void log_info(const char *fmt, ...);
+`,
+		"lib/geom/shape.hpp": `
+namespace geom {
+class Shape {
+public:
+    double area() const;
+};
+}
+`,
+		"lib/geom/shape.cc": `
+#include "shape.hpp"
+double geom::Shape::area() const { return 0; }
+`,
+		"tools/check.c": `#include "util.h"
+`,
+		"a/util.h": "int util_a;\n",
+		"b/util.h": "int util_b;\n",
+		"c/util.h": "int util_c;\n",
+	})
+
+	assertDefines(t, tagIndex, "list", "list_t", "list_new", "main", "LOG_LEVEL", "log_info", "geom", "geom::Shape", "geom::Shape::area")
+
+	expectedEdges := map[string][]string{
+		"src/main.c":         {"src/list.h", "include/util/log.h"},
+		"src/list.c":         {"src/list.h"},
+		"src/list.h":         {"src/list.c"},
+		"lib/geom/shape.cc":  {"lib/geom/shape.hpp"},
+		"lib/geom/shape.hpp": {"lib/geom/shape.cc"},
+	}
+	for from, targets := range expectedEdges {
+		for _, to := range targets {
+			if _, ok := tagIndex.FileEdges[from][to]; !ok {
+				t.Errorf("Expected file edge %s -> %s, got %v", from, to, tagIndex.FileEdges[from])
+			}
+		}
+	}
+	if edges := tagIndex.FileEdges[filepath.Join("tools", "check.c")]; len(edges) != 0 {
+		t.Errorf("Expected an ambiguous include to resolve to nothing, got %v", edges)
+	}
+
+	graph := NewTagGraphFromTagIndex(tagIndex, nil)
+	if graph.GetGraph().NumEdges() == 0 {
+		t.Error("Expected include edges in the tag graph")
+	}
+}
+
+func TestCSharpPartialClasses(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"Users/UserService.cs": `
+using Acme.Data;
+
+namespace Acme.Users
+{
+    public partial class UserService : IUserService
+    {
+        private readonly IRepository _repo;
+        public User Get(string id) => _repo.Find(id);
+    }
+}
+`,
+		"Users/UserService.Cache.cs": `
+namespace Acme.Users
+{
+    public partial class UserService
+    {
+        public string CacheKey { get; set; }
+    }
+}
+`,
+		"Orders/Order.cs": `
+using Acme.Users;
+
+namespace Acme.Orders;
+
+public record Order(string Id)
+{
+    public void Load() { new UserService().Get(Id); }
+}
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"Acme.Users",
+		"Acme.Users.UserService",
+		"Acme.Users.UserService._repo",
+		"Acme.Users.UserService.Get",
+		"Acme.Users.UserService.CacheKey",
+		"Acme.Orders.Order",
+		"Acme.Orders.Order.Load",
+	)
+	assertReferences(t, tagIndex, "Acme.Data", "Acme.Users", "IRepository")
+
+	if got := len(tagIndex.Defines["Acme.Users.UserService"]); got != 2 {
+		t.Errorf("Expected partial class to be defined in 2 files, got %d", got)
+	}
+	if _, ok := tagIndex.FileEdges["Users/UserService.cs"]["Users/UserService.Cache.cs"]; !ok {
+		t.Error("Expected partial class declarations to be linked")
+	}
+	if _, ok := tagIndex.FileEdges["Users/UserService.Cache.cs"]["Users/UserService.cs"]; !ok {
+		t.Error("Expected partial class declarations to be linked")
+	}
+}
+
+func TestSplitDefinitionsNeedPartialTypes(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"a/server.go":            "package a\n\ntype Server struct{}\n\nfunc (s *Server) Start() {}\n",
+		"b/server.go":            "package b\n\ntype Server struct{}\n\nfunc (s *Server) Start() {}\n",
+		"modules/a/variables.tf": `variable "region" {}`,
+		"modules/b/variables.tf": `variable "region" {}`,
+		"a.css":                  ".btn { color: red; }\n",
+		"b.css":                  ".btn { color: blue; }\n",
+		"Svc/A.cs":               "namespace Acme.Svc { class A {} }\n",
+		"Svc/B.cs":               "namespace Acme.Svc { class B {} }\n",
+		"Svc/C.cs":               "namespace Acme.Svc { class C {} }\n",
+		"x/one.cpp":              "namespace x { namespace y { int one() { return 1; } } }\n",
+		"x/two.cpp":              "namespace x { namespace y { int two() { return 2; } } }\n",
+	})
+
+	for from, to := range map[string]string{
+		"a/server.go":            "b/server.go",
+		"modules/a/variables.tf": "modules/b/variables.tf",
+		"a.css":                  "b.css",
+		"Svc/A.cs":               "Svc/B.cs",
+		"Svc/B.cs":               "Svc/C.cs",
+		"x/one.cpp":              "x/two.cpp",
+	} {
+		from, to = filepath.FromSlash(from), filepath.FromSlash(to)
+		if _, ok := tagIndex.FileEdges[from][to]; ok {
+			t.Errorf("Expected no file edge %s -> %s", from, to)
+		}
+		if _, ok := tagIndex.FileEdges[to][from]; ok {
+			t.Errorf("Expected no file edge %s -> %s", to, from)
+		}
+	}
+}
+
+func TestPHPNamespacesAndPSR4(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"composer.json": `{"autoload": {"psr-4": {"App\\": "src/"}}}`,
+		"src/Services/UserService.php": `<?php
+namespace App\Services;
+
+class UserService
+{
+    const CACHE_TTL = 60;
+    public function find(int $id) { return null; }
+}
+`,
+		"src/Http/UserController.php": `<?php
+namespace App\Http;
+
+use App\Services\UserService;
+use App\Legacy\Missing;
+
+trait Loggable { public function log($m) {} }
+
+class UserController
+{
+    use Loggable;
+    public function __construct(private UserService $users) {}
+    public function show() { return $this->users->find(1); }
+}
+
+function helper() {}
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"App\\Services\\UserService",
+		"App\\Services\\UserService::find",
+		"App\\Services\\UserService::CACHE_TTL",
+		"App\\Http\\UserController::show",
+		"App\\Http\\Loggable",
+		"App\\Http\\helper",
+	)
+	assertReferences(t, tagIndex, "App\\Services\\UserService", "App\\Http\\Loggable")
+
+	edges := tagIndex.FileEdges["src/Http/UserController.php"]
+	if _, ok := edges["src/Services/UserService.php"]; !ok {
+		t.Errorf("Expected use statement to resolve through PSR-4, got %v", edges)
+	}
+	if len(edges) != 1 {
+		t.Errorf("Expected only resolvable use statements to produce edges, got %v", edges)
+	}
+}
+
+func TestRubyNestingAndRequires(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"app/billing/invoice.rb": `
+require "json"
+require "billing/tax"
+require_relative "../models/user"
+
+module Billing
+  class Invoice < Base
+    TAX_RATE = 0.2
+    attr_reader :total, :items
+    validates :email
+
+    def self.build(attrs)
+      new(attrs)
+    end
+
+    def charge(user)
+      Billing::Tax.apply(total)
+    end
+  end
+end
+`,
+		"app/models/user.rb": `
+class User
+  def charge; end
+end
+`,
+		"lib/billing/tax.rb": `
+module Billing
+  class Tax
+    def self.apply(amount); end
+  end
+end
+`,
+		"app/shipping/invoice.rb": `
+module Shipping
+  class Invoice; end
+end
+`,
+		"app/serializers/json.rb": "class JsonSerializer; end\n",
+		"app/billing/tax.rb":      "module BillingTax; end\n",
+	})
+
+	assertDefines(t, tagIndex,
+		"Billing",
+		"Billing::Invoice",
+		"Billing::Invoice::TAX_RATE",
+		"Billing::Invoice::total",
+		"Billing::Invoice::items",
+		"Billing::Invoice::build",
+		"Billing::Invoice::charge",
+		"Billing::Tax::apply",
+		"Shipping::Invoice",
+		"User::charge",
+	)
+	for _, name := range []string{"Invoice", "charge", "Billing::Invoice::email"} {
+		if _, ok := tagIndex.Defines[name]; ok {
+			t.Errorf("Expected %s to be qualified or filtered out", name)
+		}
+	}
+	assertReferences(t, tagIndex, "Billing::Tax")
+
+	edges := tagIndex.FileEdges["app/billing/invoice.rb"]
+	for _, target := range []string{"lib/billing/tax.rb", "app/models/user.rb"} {
+		if _, ok := edges[target]; !ok {
+			t.Errorf("Expected require edge to %s, got %v", target, edges)
+		}
+	}
+	if len(edges) != 2 {
+		t.Errorf("Expected require to resolve through lib only, got %v", edges)
+	}
+}
+
+func TestSwiftScalaGroovyTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"App/UserService.swift": `
+import Foundation
+
+protocol Repository { func find(id: Int) -> User? }
+
+class UserService: Repository {
+    var cache: [Int: User] = [:]
+    func find(id: Int) -> User? { return nil }
+}
+
+extension UserService {
+    func reset() { cache = [:] }
+}
+`,
+		"src/main/scala/Users.scala": `
+package com.acme.users
+
+import com.acme.core.Repo
+
+trait Service { def run(): Unit }
+
+object UserService extends Service {
+  val MaxUsers = 3
+  def run(): Unit = helper()
+}
+`,
+		"build.gradle": `
+task integrationTest(type: Test) {
+    dependsOn 'compileJava'
+}
+
+task hello {
+    doLast { println 'hello' }
+}
+`,
+		"src/main/groovy/Report.groovy": `
+package com.acme.reports
+
+class Report {
+    String title
+    def render() { format(title) }
+}
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"Repository", "Repository.find",
+		"UserService", "UserService.cache", "UserService.find", "UserService.reset",
+		"com.acme.users.Service", "com.acme.users.Service.run",
+		"com.acme.users.UserService", "com.acme.users.UserService.MaxUsers",
+		"integrationTest", "hello",
+		"com.acme.reports.Report", "com.acme.reports.Report.title", "com.acme.reports.Report.render",
+	)
+	assertReferences(t, tagIndex, "Foundation", "Repo", "compileJava", "format")
+	if _, ok := tagIndex.References["task"]; ok {
+		t.Error("Expected the task keyword not to be referenced")
+	}
+}
+
+func TestFunctionalLanguageTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"lib/accounts.ex": `
+defmodule MyApp.Accounts do
+  alias MyApp.Repo
+
+  def get_user(id), do: Repo.get(User, id)
+
+  defp normalize(email) when is_binary(email) do
+    String.downcase(email)
+  end
+
+  defmodule Token do
+    defmacro sign(data), do: data
+  end
+end
+`,
+		"lib/billing.ex": `
+defmodule MyApp.Billing do
+  def get_user(invoice), do: MyApp.Accounts.get_user(invoice.user_id)
+end
+`,
+		"src/accounts.ml": `
+open Core
+
+module Store = struct
+  type user = { id : int }
+  let find id = Hashtbl.find table id
+end
+
+module type SERVICE = sig
+  val run : unit -> unit
+end
+
+let main () = Store.find 1
+
+let get_user id = Store.find id
+`,
+		"src/billing.ml": `
+let get_user invoice = invoice
+`,
+		"src/main.ml": `
+let () = ignore (Accounts.get_user 1)
+`,
+		"src/Billing/Invoice.elm": `
+module Billing.Invoice exposing (Invoice, total)
+
+import Billing.Tax as Tax exposing (rate)
+
+type alias Invoice = { amount : Int }
+
+type Status = Paid | Open
+
+total : Invoice -> Int
+total inv = Tax.apply inv.amount
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"MyApp.Accounts", "MyApp.Accounts.get_user", "MyApp.Accounts.normalize",
+		"MyApp.Accounts.Token", "MyApp.Accounts.Token.sign",
+		"MyApp.Billing", "MyApp.Billing.get_user",
+		"Accounts.Store", "Accounts.Store.user", "Accounts.Store.find",
+		"Accounts.SERVICE", "Accounts.SERVICE.run", "Accounts.main", "Accounts.get_user", "Billing.get_user",
+		"Billing.Invoice.Invoice", "Billing.Invoice.Status", "Billing.Invoice.Paid", "Billing.Invoice.total",
+	)
+	assertReferences(t, tagIndex,
+		"MyApp.Repo", "Repo.get", "String.downcase", "MyApp.Accounts.get_user", "Core", "Hashtbl",
+		"Hashtbl.find", "Store.find", "Accounts.get_user", "Billing.Tax", "rate", "apply",
+	)
+
+	for _, name := range []string{"get_user", "MyApp.Accounts.alias", "MyApp.Accounts.id"} {
+		if _, ok := tagIndex.Defines[name]; ok {
+			t.Errorf("Unexpected definition: %s", name)
+		}
+	}
+
+	main := filepath.Join("src", "main.ml")
+	if !contains(tagIndex.References["Accounts.get_user"], main) {
+		t.Errorf("Expected %s to reference Accounts.get_user", main)
+	}
+	if contains(tagIndex.References["Billing.get_user"], main) {
+		t.Errorf("Expected %s not to reference Billing.get_user", main)
+	}
+	if !contains(tagIndex.References["MyApp.Accounts.get_user"], filepath.Join("lib", "billing.ex")) {
+		t.Error("Expected lib/billing.ex to reference MyApp.Accounts.get_user")
+	}
+}
+
+func TestBashSourceEdges(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"deploy/deploy.sh": `#!/bin/bash
+source ./lib/common.sh
+. "$DIR/ignored.sh"
+
+deploy() {
+  log_info "deploying"
+  build_image "$1"
+}
+
+function build_image {
+  docker build .
+}
+
+deploy prod
+`,
+		"deploy/lib/common.sh": `
+log_info() { echo "$@"; }
+`,
+	})
+
+	assertDefines(t, tagIndex, "deploy", "build_image", "log_info")
+	assertReferences(t, tagIndex, "log_info", "build_image", "deploy")
+
+	if _, ok := tagIndex.References["source"]; ok {
+		t.Error("source should not be recorded as a call")
+	}
+
+	edges := tagIndex.FileEdges[filepath.Join("deploy", "deploy.sh")]
+	if _, ok := edges[filepath.Join("deploy", "lib", "common.sh")]; !ok {
+		t.Errorf("Expected source edge to deploy/lib/common.sh, got %v", edges)
+	}
+	if len(edges) != 1 {
+		t.Errorf("Expected exactly one source edge, got %v", edges)
+	}
+}
+
+func TestSQLSchemaTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"migrations/001_users.sql": `
+CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+CREATE INDEX idx_users_email ON users (email);
+`,
+		"migrations/002_orders.sql": `
+CREATE TABLE orders (
+  id INT PRIMARY KEY,
+  user_id INT,
+  FOREIGN KEY (user_id) REFERENCES public.users (id)
+);
+CREATE VIEW active_users AS
+  SELECT u.id FROM users u JOIN orders o ON o.user_id = u.id;
+CREATE FUNCTION order_count(uid INT) RETURNS INT AS $$
+  SELECT count(*) FROM orders WHERE user_id = uid
+$$ LANGUAGE sql;
+`,
+		"queries/seed.sql": `
+INSERT INTO users (id, email) VALUES (1, 'a@example.com');
+`,
+	})
+
+	assertDefines(t, tagIndex, "users", "idx_users_email", "orders", "active_users", "order_count")
+	assertReferences(t, tagIndex, "users", "orders")
+
+	refFiles := make(map[string]struct{})
+	for _, file := range tagIndex.References["users"] {
+		refFiles[file] = struct{}{}
+	}
+	for _, file := range []string{
+		filepath.Join("migrations", "002_orders.sql"),
+		filepath.Join("queries", "seed.sql"),
+	} {
+		if _, ok := refFiles[file]; !ok {
+			t.Errorf("Expected %s to reference users, got %v", file, tagIndex.References["users"])
+		}
+	}
+}
+
+func TestProtobufGeneratedEdges(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"proto/acme/users/v1/user.proto": `
+syntax = "proto3";
+package acme.users.v1;
+
+import "acme/common/v1/page.proto";
+
+message User {
+  string id = 1;
+  Status status = 2;
+  message Address { string city = 1; }
+}
+
+enum Status { ACTIVE = 0; }
+
+service UserService {
+  rpc ListUsers(acme.common.v1.Page) returns (stream User);
+}
+`,
+		"proto/acme/common/v1/page.proto": `
+syntax = "proto3";
+package acme.common.v1;
+
+message Page { int32 size = 1; }
+`,
+		"gen/go/usersv1/user.pb.go": `// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: acme/users/v1/user.proto
+
+package usersv1
+
+type User struct{ Id string }
+`,
+		"gen/py/user_pb2.py": `# Generated by the protocol buffer compiler.  DO NOT EDIT!
+from google.protobuf import descriptor as _descriptor
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"acme.users.v1.User", "acme.users.v1.User.Address", "acme.users.v1.Status",
+		"acme.users.v1.UserService", "acme.users.v1.UserService.ListUsers",
+		"acme.common.v1.Page",
+	)
+	assertReferences(t, tagIndex, "Status", "acme.common.v1.Page", "User")
+
+	userProto := filepath.Join("proto", "acme", "users", "v1", "user.proto")
+	for from, to := range map[string]string{
+		userProto: filepath.Join("proto", "acme", "common", "v1", "page.proto"),
+		filepath.Join("gen", "go", "usersv1", "user.pb.go"): userProto,
+		filepath.Join("gen", "py", "user_pb2.py"):           userProto,
+	} {
+		if _, ok := tagIndex.FileEdges[from][to]; !ok {
+			t.Errorf("Expected file edge %s -> %s, got %v", from, to, tagIndex.FileEdges[from])
+		}
+	}
+}
+
+func TestTerraformAddresses(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"infra/main.tf": `
+variable "region" { default = "us-east-1" }
+
+locals {
+  name = "app-${var.region}"
+}
+
+resource "aws_s3_bucket" "logs" {
+  bucket = local.name
+}
+
+data "aws_iam_policy" "ro" { arn = aws_s3_bucket.logs.arn }
+
+module "network" {
+  source = "./modules/network"
+  policy = data.aws_iam_policy.ro.arn
+}
+
+module "dns" {
+  source = "terraform-aws-modules/route53/aws"
+}
+
+output "vpc" { value = module.network.vpc_id }
+`,
+		"infra/modules/network/main.tf": `
+resource "aws_vpc" "main" { cidr_block = var.cidr }
+`,
+		"infra/modules/network/variables.tf": `
+variable "cidr" {}
+variable "region" {}
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"infra/var.region", "infra/local.name", "aws_s3_bucket.logs", "data.aws_iam_policy.ro",
+		"module.network", "module.dns", "output.vpc", "aws_vpc.main",
+		"infra/modules/network/var.cidr", "infra/modules/network/var.region",
+	)
+	assertReferences(t, tagIndex,
+		"infra/var.region", "infra/local.name", "aws_s3_bucket.logs", "data.aws_iam_policy.ro",
+		"module.network", "infra/modules/network/var.cidr",
+	)
+	if refs := tagIndex.References["infra/modules/network/var.region"]; len(refs) != 0 {
+		t.Errorf("Expected var.region of the root module not to refer to the network module, got %v", refs)
+	}
+
+	for name, kind := range map[string]string{
+		"aws_s3_bucket.logs":     "resource",
+		"data.aws_iam_policy.ro": "data",
+		"module.network":         "module",
+		"infra/var.region":       "variable",
+		"output.vpc":             "output",
+		"infra/local.name":       "local",
+	} {
+		tags := tagIndex.Definitions[filepath.Join("infra", "main.tf", name)]
+		if len(tags) != 1 || tags[0].SymbolKind != kind {
+			t.Errorf("Expected %s to be tagged as %s, got %v", name, kind, tags)
+		}
+	}
+
+	edges := tagIndex.FileEdges[filepath.Join("infra", "main.tf")]
+	for _, target := range []string{
+		filepath.Join("infra", "modules", "network", "main.tf"),
+		filepath.Join("infra", "modules", "network", "variables.tf"),
+	} {
+		if _, ok := edges[target]; !ok {
+			t.Errorf("Expected module edge to %s, got %v", target, edges)
+		}
+	}
+	if len(edges) != 2 {
+		t.Errorf("Expected only local module sources to produce edges, got %v", edges)
+	}
+}
+
+func TestDockerfileStages(t *testing.T) {
+	dockerfile := `
+FROM golang:1.22 AS builder
+COPY go.mod go.sum ./
+COPY cmd/ ./cmd/
+RUN go build -o /app ./cmd/server
+
+FROM builder AS test
+RUN go test ./...
+
+FROM alpine:3.19
+COPY --from=builder /app /app
+COPY --from=builder app/bin /bin
+COPY --chown=app:app config/app.yaml /etc/app.yaml
+`
+	tagIndex := generateTags(t, map[string]string{
+		"Dockerfile":               dockerfile,
+		"deploy/Dockerfile.prod":   "FROM alpine AS runtime\n",
+		"deploy/worker.dockerfile": "FROM runtime\n",
+		"go.mod":                   "module example.com/app\n",
+		"cmd/server/main.go":       "package main\n\nfunc main() {}\n",
+		"config/app.yaml":          "port: 8080\n",
+		"app/bin/server":           "#!/bin/sh\n",
+	})
+
+	assertDefines(t, tagIndex, "builder", "test", "runtime")
+	assertReferences(t, tagIndex, "builder", "runtime")
+
+	if refs := tagIndex.References["builder"]; len(refs) != 3 {
+		t.Errorf("Expected FROM and COPY --from references to builder, got %v", refs)
+	}
+
+	edges := tagIndex.FileEdges["Dockerfile"]
+	for _, target := range []string{"go.mod", filepath.Join("cmd", "server", "main.go"), filepath.Join("config", "app.yaml")} {
+		if _, ok := edges[target]; !ok {
+			t.Errorf("Expected COPY edge to %s, got %v", target, edges)
+		}
+	}
+	if len(edges) != 3 {
+		t.Errorf("Expected only repository sources to produce edges, got %v", edges)
+	}
+}
+
+func TestYAMLManifestTags(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"k8s/web.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: acme/web:1.2
+          envFrom:
+            - configMapRef:
+                name: web-config
+            - secretRef:
+                name: web-secrets
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  LOG_LEVEL: debug
+`,
+		"docker-compose.yml": `
+services:
+  api:
+    image: acme/api
+    depends_on:
+      - db
+  db:
+    image: postgres:16
+    depends_on: [cache]
+  cache:
+    image: redis
+`,
+		"config/settings.yml": `
+database:
+  host: localhost
+  pool:
+    size: 5
+features: [search]
+`,
+	})
+
+	assertDefines(t, tagIndex,
+		"Deployment/web", "ConfigMap/web-config",
+		"api", "db", "cache",
+		"database", "features",
+	)
+	assertReferences(t, tagIndex,
+		"ConfigMap/web-config", "Secret/web-secrets", "acme/web:1.2",
+		"db", "cache", "postgres:16",
+	)
+
+	for _, name := range []string{"apiVersion", "kind", "metadata", "spec", "data", "services", "host", "pool", "size"} {
+		if _, ok := tagIndex.Defines[name]; ok {
+			t.Errorf("Unexpected definition: %s", name)
+		}
+	}
+}
+
+func TestCSSSelectorLinks(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"styles/app.css": `
+.btn, .btn-primary:hover { color: red; }
+#main > .card .title { margin: 0; }
+@media (max-width: 600px) { .card { padding: 0; } }
+`,
+		"public/index.html": `
+<div id="main" class="card  btn">
+  <span class='title'>Hi</span>
+</div>
+`,
+		"src/Card.js": `
+const Card = () => <div className="card title" onClick={open}>Hi</div>;
+`,
+		"src/Button.svelte": `
+<button class="btn btn-primary">Go</button>
+<span class="btn {active ? 'x' : ''} title">On</span>
+`,
+	})
+
+	assertDefines(t, tagIndex, ".btn", ".btn-primary", "#main", ".card", ".title")
+	assertReferences(t, tagIndex, ".btn", ".btn-primary", "#main", ".card", ".title")
+
+	if _, ok := tagIndex.Defines[".hover"]; ok {
+		t.Error("Pseudo-classes should not be tagged as class selectors")
+	}
+	for name := range tagIndex.References {
+		if strings.HasPrefix(name, ".") && strings.ContainsAny(name, "{}?:'") {
+			t.Errorf("Expected expressions in class attributes to be skipped, got %s", name)
+		}
+	}
+	for file, classes := range map[string][]string{
+		filepath.Join("public", "index.html"): {".card", ".btn", ".title"},
+		filepath.Join("src", "Card.js"):       {".card", ".title"},
+		filepath.Join("src", "Button.svelte"): {".btn", ".btn-primary", ".title"},
+	} {
+		for _, class := range classes {
+			if !contains(tagIndex.References[class], file) {
+				t.Errorf("Expected %s to reference %s, got %v", file, class, tagIndex.References[class])
+			}
+		}
+	}
+}
+
+func TestCSSSelectorsStayApartFromCode(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"src/state.js": "export const active = true;\n",
+		"src/Button.jsx": `import { active } from './state';
+
+export const Button = () => <button className="active" disabled={!active}>Go</button>;
+`,
+		"src/button.css": ".active { color: red; }\n",
+	})
+
+	button := filepath.Join("src", "Button.jsx")
+	if !contains(tagIndex.References["active"], button) {
+		t.Errorf("Expected %s to reference active, got %v", button, tagIndex.References["active"])
+	}
+	if !contains(tagIndex.References[".active"], button) {
+		t.Errorf("Expected %s to reference .active, got %v", button, tagIndex.References[".active"])
+	}
+	if _, ok := tagIndex.FileEdges[button][filepath.Join("src", "state.js")]; !ok {
+		t.Errorf("Expected an import edge to state.js, got %v", tagIndex.FileEdges[button])
+	}
+}
+
+func TestEmbeddedScriptInjection(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"src/Counter.svelte": `<script lang="ts">
+  import { format } from './format';
+
+  export function increment(count: number): number {
+    return format(count + 1);
+  }
+</script>
+
+<button class="counter">+</button>
+
+<style>
+  .counter { color: red; }
+</style>
+`,
+		"public/index.html": `<!doctype html>
+<html>
+  <body>
+    <script>
+      function boot() { render(); }
+    </script>
+  </body>
+</html>
+`,
+	})
+
+	assertDefines(t, tagIndex, "increment", "boot", ".counter")
+	assertReferences(t, tagIndex, "format", "render", ".counter")
+
+	lines := make(map[string]int)
+	for _, tags := range tagIndex.Definitions {
+		for _, tag := range tags {
+			lines[tag.Name] = tag.Line
+		}
+	}
+	for name, line := range map[string]int{"increment": 4, "boot": 5, ".counter": 12} {
+		if lines[name] != line {
+			t.Errorf("Expected %s on host line %d, got %d", name, line, lines[name])
+		}
+	}
+}
+
+func TestMarkdownAndNotebookBlocks(t *testing.T) {
+	// Raw strings cannot hold backticks, so the document is written with '
+	design := strings.ReplaceAll(`# Architecture Overview
+
+The 'UserService' wraps 'db.Query' and '  not code '.
+
+Setext Title
+============
+
+'''go
+func Handle() {}
+'''
+`, "'", "`")
+
+	tagIndex := generateTags(t, map[string]string{
+		"docs/design.md": design,
+		"notebooks/explore.ipynb": `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": ["# Notes\n"]
+  },
+  {
+   "cell_type": "code",
+   "metadata": {},
+   "source": [
+    "import pandas as pd\n",
+    "\n",
+    "def load(path):\n",
+    "    return pd.read_csv(path)"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "metadata": {},
+   "source": ["class Report:\n", "    pass\n"]
+  }
+ ],
+ "metadata": {
+  "kernelspec": {"language": "python", "name": "python3"}
+ },
+ "nbformat": 4
+}
+`,
+	})
+
+	assertDefines(t, tagIndex, "Architecture Overview", "Setext Title", "Handle", "load", "Report")
+	assertReferences(t, tagIndex, "UserService", "db.Query", "read_csv")
+
+	if _, ok := tagIndex.References["  not code "]; ok {
+		t.Error("Inline code that is not an identifier should not be referenced")
+	}
+
+	lines := make(map[string]int)
+	for _, tags := range tagIndex.Definitions {
+		for _, tag := range tags {
+			lines[tag.Name] = tag.Line
+		}
+	}
+	for name, line := range map[string]int{"Architecture Overview": 1, "Handle": 9, "load": 14, "Report": 21} {
+		if lines[name] != line {
+			t.Errorf("Expected %s on host line %d, got %d", name, line, lines[name])
+		}
+	}
+}
+
+func TestTypeScriptModules(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"web/tsconfig.json": `{
+  // Comments and trailing commas are allowed here
+  "compilerOptions": {
+    "baseUrl": ".",
+    "paths": {
+      "@app/*": ["src/*"], /* aliases */
+    },
+  },
+}`,
+		"web/src/services/user.ts": `
+import { User } from '../models/user';
+import { format } from './format.js';
+import type { Config } from '@app/config';
+import * as util from '../util';
+import React from 'react';
+
+export interface Repo<T> { find(id: string): T; }
+export type ID = string;
+export enum Role { Admin, Member }
+export const loadUser = async (id: ID): Promise<User> => format(await fetchUser(id));
+`,
+		"web/src/models/user.ts":     "export class User {}\n",
+		"web/src/services/format.ts": "export function format(u) { return u; }\n",
+		"web/src/config.ts":          "export const config = {};\n",
+		"web/src/util/index.ts":      "export * from './strings';\n",
+		"web/src/util/strings.ts":    "export const trim = (s: string) => s.trim();\n",
+		"web/src/components/Profile.tsx": `
+import { loadUser } from '@app/services/user';
+
+export const Profile = () => <div className="profile">{loadUser('1')}</div>;
+`,
+		"web/src/legacy.cjs": "const strings = require('./util/strings');\n",
+	})
+
+	assertDefines(t, tagIndex, "Repo", "ID", "Role", "loadUser", "Profile", "User", "trim", "config")
+	assertReferences(t, tagIndex, "User", "ID", "fetchUser", "loadUser", ".profile")
+
+	for path, kinds := range map[string]map[string]string{
+		"web/src/services/user.ts":       {"loadUser": "function"},
+		"web/src/components/Profile.tsx": {"Profile": "function"},
+		"web/src/util/strings.ts":        {"trim": "function"},
+		"web/src/config.ts":              {"config": "variable"},
+	} {
+		for name, kind := range kinds {
+			tags := tagIndex.Definitions[filepath.Join(filepath.FromSlash(path), name)]
+			if len(tags) != 1 || tags[0].SymbolKind != kind {
+				t.Errorf("Expected %s in %s to be tagged as %s, got %v", name, path, kind, tags)
+			}
+		}
+	}
+
+	src := filepath.Join("web", "src")
+	for from, targets := range map[string][]string{
+		filepath.Join(src, "services", "user.ts"): {
+			filepath.Join(src, "models", "user.ts"),
+			filepath.Join(src, "services", "format.ts"),
+			filepath.Join(src, "config.ts"),
+			filepath.Join(src, "util", "index.ts"),
+		},
+		filepath.Join(src, "util", "index.ts"):          {filepath.Join(src, "util", "strings.ts")},
+		filepath.Join(src, "components", "Profile.tsx"): {filepath.Join(src, "services", "user.ts")},
+		filepath.Join(src, "legacy.cjs"):                {filepath.Join(src, "util", "strings.ts")},
+	} {
+		edges := tagIndex.FileEdges[from]
+		for _, target := range targets {
+			if _, ok := edges[target]; !ok {
+				t.Errorf("Expected import edge %s -> %s, got %v", from, target, edges)
+			}
+		}
+		if len(edges) != len(targets) {
+			t.Errorf("Expected %d import edges from %s, got %v", len(targets), from, edges)
+		}
+	}
+}
+
+func TestGoReceiversAndFields(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"go.mod": "module example.com/app // the app\n\ngo 1.21\n",
+		"services/user.go": `package services
+
+import (
+	"fmt"
+
+	"example.com/app/models"
+)
+
+const MaxUsers = 10
+
+const (
+	ModeRead, ModeWrite = 1, 2
+)
+
+var cache = map[string]models.User{}
+
+var (
+	defaultLimit = 10
+	lastErr      error
+)
+
+type Repo[T any] interface {
+	Find(id string) (T, error)
+}
+
+type UserService struct {
+	repo  Repo[models.User]
+	limit int
+}
+
+func (s *UserService) GetUser(id string) (models.User, error) {
+	const attempts = 3
+	return s.repo.Find(fmt.Sprint(id))
+}
+
+func (c Cache[K]) Get(key K) {}
+`,
+		"models/user.go":      "package models\n\ntype User struct{ Name string }\n",
+		"models/user_test.go": "package models\n",
+		"legacy/user.go":      "package services\n\ntype UserService struct{}\n",
+	})
+
+	assertDefines(t, tagIndex,
+		"services.MaxUsers", "services.ModeRead", "services.ModeWrite", "services.cache",
+		"services.defaultLimit", "services.lastErr",
+		"services.Repo", "services.Repo.Find", "services.UserService",
+		"services.UserService.repo", "services.UserService.limit",
+		"services.UserService.GetUser", "services.Cache.Get", "models.User.Name",
+		"legacy.UserService",
+	)
+	assertReferences(t, tagIndex, "fmt", "example.com/app/models", "Find")
+
+	if got := len(tagIndex.Defines["services.UserService"]); got != 1 {
+		t.Errorf("Expected services.UserService defined in exactly one file, got %d", got)
+	}
+	for _, name := range []string{"GetUser", "UserService.GetUser", "services.attempts", "(s *UserService)"} {
+		if _, ok := tagIndex.Defines[name]; ok {
+			t.Errorf("Unexpected definition: %s", name)
+		}
+	}
+
+	edges := tagIndex.FileEdges[filepath.Join("services", "user.go")]
+	if _, ok := edges[filepath.Join("models", "user.go")]; !ok || len(edges) != 1 {
+		t.Errorf("Expected a single import edge to models/user.go, got %v", edges)
+	}
+
+	middleware := NewTagIndex(filepath.Join("testdata", "web"))
+	files, err := middleware.GetFiles(filepath.Join("testdata", "web", "middleware"))
+	if err != nil {
+		t.Fatalf("Failed to read test files: %v", err)
+	}
+	if err := middleware.GenerateFromFiles(context.Background(), files); err != nil {
+		t.Fatalf("Failed to generate tags: %v", err)
+	}
+	for _, name := range []string{"middleware.AuthMiddleware.Handle", "middleware.LoggingMiddleware.Handle"} {
+		if got := len(middleware.Defines[name]); got != 1 {
+			t.Errorf("Expected %s defined in exactly one file, got %d", name, got)
+		}
+	}
+}
+
+func TestRegisterLanguage(t *testing.T) {
+	t.Cleanup(func() {
+		languages.mu.Lock()
+		defer languages.mu.Unlock()
+		delete(languages.byName, "starlark")
+		delete(languages.byExt, "star")
+		delete(languages.byFilename, "build")
+	})
+
+	starlarkQuery := `(function_definition name: (identifier) @def.function)
+(call function: (identifier) @ref.call)`
+	if err := RegisterLanguage("Starlark", []string{"star"}, []string{"BUILD"}, python.GetLanguage(), starlarkQuery); err != nil {
+		t.Fatalf("Failed to register language: %v", err)
+	}
+
+	// Overriding a bundled query keeps its grammar and extensions
+	defer RegisterLanguage("python", nil, nil, nil, pythonQuery)
+	if err := RegisterLanguage("python", nil, nil, nil, `(class_definition name: (identifier) @def.class)`); err != nil {
+		t.Fatalf("Failed to override language: %v", err)
+	}
+
+	tagIndex := generateTags(t, map[string]string{
+		"rules.star":  "def cc_rule(name):\n    native_rule(name)\n",
+		"pkg/BUILD":   "cc_rule(name = 'pkg')\n",
+		"lib/main.py": "class Main:\n    pass\n\ndef helper():\n    pass\n",
+	})
+	assertDefines(t, tagIndex, "cc_rule", "Main")
+	assertReferences(t, tagIndex, "native_rule", "cc_rule")
+	if _, ok := tagIndex.Defines["helper"]; ok {
+		t.Errorf("Expected the overridden Python query to skip functions")
+	}
+
+	if lang := languageForPath(filepath.Join("pkg", "BUILD")); lang == nil || lang.name != "starlark" {
+		t.Errorf("Expected BUILD files to be Starlark, got %v", lang)
+	}
+	if lang := languageForPath("main.py"); lang == nil || lang.grammar == nil {
+		t.Errorf("Expected Python to keep its grammar")
+	}
+
+	rm := NewRepoMap()
+	if out := rm.renderTree("rules.star", []byte("def cc_rule(name):\n    native_rule(name)\n"), []int{0}); !strings.Contains(out, "cc_rule") {
+		t.Errorf("Expected rendered Starlark, got %q", out)
+	}
+
+	// Aliases name the language they stand for
+	defer RegisterLanguage("bash", nil, nil, nil, bashQuery)
+	if err := RegisterLanguage("shell", nil, nil, nil, "(function_definition name: (word) @def.function)"); err != nil {
+		t.Fatalf("Failed to override language by alias: %v", err)
+	}
+	if lang := languageFor("bash"); lang == nil || !strings.Contains(lang.query, "@def.function") || lang.query == bashQuery {
+		t.Errorf("Expected the shell alias to override the bash query")
+	}
+	if _, ok := languages.byName["shell"]; ok {
+		t.Errorf("Expected no language registered under the shell alias")
+	}
+	if err := RegisterLanguage("golang", nil, nil, nil, goQuery); err != nil {
+		t.Errorf("Expected golang to name the Go language, got %v", err)
+	}
+
+	// Overriding a query does not take back the extensions another language
+	// claimed since
+	cpp := languageFor("cpp")
+	t.Cleanup(func() {
+		languages.mu.Lock()
+		defer languages.mu.Unlock()
+		delete(languages.byName, "myc")
+		languages.add(cpp)
+	})
+	if err := RegisterLanguage("myc", []string{"h"}, nil, c.GetLanguage(), ""); err != nil {
+		t.Fatalf("Failed to register language: %v", err)
+	}
+	if err := RegisterLanguage("cpp", nil, nil, nil, cppQuery); err != nil {
+		t.Fatalf("Failed to override language: %v", err)
+	}
+	if lang := languageForPath("util.h"); lang == nil || lang.name != "myc" {
+		t.Errorf("Expected .h files to stay with myc, got %v", lang)
+	}
+	if lang := languageForPath("util.hpp"); lang == nil || lang.name != "cpp" {
+		t.Errorf("Expected .hpp files to stay with cpp, got %v", lang)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		grammar *tree_sitter.Language
+		query   string
+	}{
+		{"", python.GetLanguage(), ""},
+		{"unknown", nil, ""},
+		{"broken", python.GetLanguage(), "(no_such_node) @def.function"},
+	} {
+		if err := RegisterLanguage(tc.name, nil, nil, tc.grammar, tc.query); err == nil {
+			t.Errorf("Expected an error registering %q", tc.name)
+		}
+	}
+}
+
+func TestLoadQueryDir(t *testing.T) {
+	t.Cleanup(func() {
+		RegisterLanguage("go", nil, nil, nil, goQuery)
+		RegisterLanguage("python", nil, nil, nil, pythonQuery)
+	})
+
+	dir := t.TempDir()
+	queryFiles := map[string]string{
+		// Extends the bundled Go query
+		"go.scm": "; extends\n(labeled_statement label: (label_name) @name) @definition.label\n",
+		// Replaces the bundled Python query
+		filepath.Join("python", "tags.scm"): `(class_definition name: (identifier) @name.definition.class) @definition.class
+(call function: (identifier) @name) @reference.call
+`,
+		"ts-tags.scm": "(function_declaration name: (identifier) @defintion.function)\n",
+		"ruby.scm":    "; tags\n  (no_such_node) @definition.thing\n",
+		"bash.scm":    "((function_definition name: (word) @name) @definition.function (#match? @name \"[\"))\n",
+		"cobol.scm":   "(program) @definition.program\n",
+		"README.md":   "not a query\n",
+	}
+	for name, content := range queryFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := LoadQueryDir(dir)
+	if err == nil {
+		t.Fatal("Expected errors for the invalid query files")
+	}
+	queryErrors := make(map[string]*QueryError)
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var qerr *QueryError
+		if !errors.As(err, &qerr) {
+			t.Fatalf("Expected a QueryError, got %v", err)
+		}
+		queryErrors[filepath.Base(qerr.File)] = qerr
+	}
+
+	for _, tc := range []struct {
+		file    string
+		capture string
+		line    int
+	}{
+		{"ts-tags.scm", "defintion.function", 1},
+		{"ruby.scm", "definition.thing", 2},
+		{"bash.scm", "name", 1},
+		{"cobol.scm", "", 0},
+	} {
+		qerr, ok := queryErrors[tc.file]
+		if !ok {
+			t.Errorf("Expected an error for %s", tc.file)
+			continue
+		}
+		if qerr.Capture != tc.capture || qerr.Line != tc.line {
+			t.Errorf("Expected %s to fail at line %d in @%s, got %v", tc.file, tc.line, tc.capture, qerr)
+		}
+		if !strings.Contains(qerr.Error(), tc.file) {
+			t.Errorf("Expected the error to name %s, got %q", tc.file, qerr.Error())
+		}
+	}
+	if len(queryErrors) != 4 {
+		t.Errorf("Expected 4 query errors, got %v", err)
+	}
+	for name, query := range map[string]string{"typescript": typescriptQuery, "ruby": rubyQuery, "bash": bashQuery} {
+		if languageFor(name).query != query {
+			t.Errorf("Expected the %s query to be left untouched", name)
+		}
+	}
+
+	tagIndex := generateTags(t, map[string]string{
+		"main.go": "package main\n\nfunc main() {\nouter:\n\tfor {\n\t\tbreak outer\n\t}\n}\n",
+		"app.py":  "class App:\n    pass\n\ndef run():\n    App()\n",
+	})
+	assertDefines(t, tagIndex, "main", "outer", "App")
+	assertReferences(t, tagIndex, "App")
+	if _, ok := tagIndex.Defines["run"]; ok {
+		t.Errorf("Expected the replaced Python query to skip functions")
+	}
+	if tags := tagIndex.Defines["App"]; len(tags) != 1 {
+		t.Errorf("Expected App defined once, got %v", tags)
+	}
+}
+
+func TestRegisterLanguageLibrary(t *testing.T) {
+	// Build a grammar library from the TOML sources bundled with go-tree-sitter
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler available")
+	}
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "github.com/smacker/go-tree-sitter").Output()
+	if err != nil {
+		t.Skipf("go-tree-sitter sources not available: %v", err)
+	}
+	src := filepath.Join(strings.TrimSpace(string(out)), "toml")
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libtoml.so")
+	build := exec.Command(cc, "-shared", "-fPIC", "-o", library, filepath.Join(src, "parser.c"), filepath.Join(src, "scanner.c"))
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("failed to build grammar library: %v\n%s", err, out)
+	}
+
+	bundled := languageFor("toml")
+	t.Cleanup(func() {
+		languages.mu.Lock()
+		defer languages.mu.Unlock()
+		languages.add(bundled)
+	})
+
+	queryPath := filepath.Join(dir, "tags.scm")
+	query := "(table (bare_key) @name) @definition.table\n(pair (bare_key) @definition.key)\n"
+	if err := os.WriteFile(queryPath, []byte(query), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLanguageLibrary("toml", library, queryPath, []string{"toml"}, []string{"Pipfile"}); err != nil {
+		t.Fatalf("Failed to register grammar library: %v", err)
+	}
+	if lang := languageForPath("Pipfile"); lang == nil || lang.grammar == bundled.grammar {
+		t.Errorf("Expected Pipfile to use the loaded grammar")
+	}
+
+	tagIndex := generateTags(t, map[string]string{
+		"config.toml": "[server]\nhost = \"localhost\"\n",
+		"Pipfile":     "[packages]\nrequests = \"*\"\n",
+	})
+	assertDefines(t, tagIndex, "server", "host", "packages", "requests")
+
+	if _, err := LoadGrammar(filepath.Join(dir, "missing.so"), "toml"); err == nil {
+		t.Errorf("Expected an error loading a missing library")
+	}
+	if _, err := LoadGrammar(library, "yaml"); err == nil || !strings.Contains(err.Error(), "tree_sitter_yaml") {
+		t.Errorf("Expected an error naming the missing symbol, got %v", err)
+	}
+
+	badQuery := filepath.Join(dir, "bad.scm")
+	if err := os.WriteFile(badQuery, []byte("(no_such_node) @definition.thing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var qerr *QueryError
+	if err := RegisterLanguageLibrary("toml", library, badQuery, nil, nil); !errors.As(err, &qerr) || qerr.File != badQuery {
+		t.Errorf("Expected a QueryError for %s, got %v", badQuery, err)
+	}
+}
+
+func TestLanguageDetection(t *testing.T) {
+	tagIndex := generateTags(t, map[string]string{
+		"Makefile":              "all:\n\tpython3 build.py\n",
+		"Jenkinsfile":           "def deployStage() {\n  echo 'deploy'\n}\n",
+		"Rakefile":              "def build_assets\nend\n",
+		"Gemfile":               "def gem_group\nend\n",
+		"bin/serve":             "#!/usr/bin/env python3.12\ndef serve():\n    pass\n",
+		"bin/run":               "#!/usr/bin/env -S node --no-warnings\nfunction runTask() {}\n",
+		"bin/deploy":            "#!/bin/bash\ndeploy_all() { echo; }\n",
+		"bin/report":            "#!/usr/bin/perl\nsub report_main { }\n",
+		"scripts/tool":          "def tool_main\nend\n# vim: set ts=2 ft=ruby:\n",
+		"lib/legacy.inc":        "// -*- mode: C++ -*-\nclass Legacy {};\n",
+		"lib/helpers.py":        "# -*- coding: utf-8 -*-\ndef helper():\n    pass\n",
+		".gitattributes":        "*.tmpl linguist-language=Go\n/gen/** linguist-language=Shell\n",
+		"views/page.tmpl":       "package views\n\nfunc Render() {}\n",
+		"gen/setup.py":          "setup_env() { echo; }\n",
+		"legacy/.gitattributes": "*.tmpl -linguist-language\n",
+		"legacy/old.tmpl":       "package legacy\n\nfunc Old() {}\n",
+		"notes.txt":             "def not_code():\n    pass\n",
+		"LICENSE":               "function notCode() {}\n",
+		"scripts/long":          strings.Repeat("\n", 20) + "def long_main\nend\n# vim: ft=ruby\n",
+		"scripts/middle":        strings.Repeat("\n", 10) + "# vim: ft=ruby\ndef middle_main\nend\n" + strings.Repeat("\n", 10),
+	})
+
+	assertDefines(t, tagIndex,
+		"deployStage", "build_assets", "gem_group", "serve", "runTask", "deploy_all",
+		"tool_main", "Legacy", "helper", "views.Render", "setup_env", "long_main",
+	)
+	for _, name := range []string{"report_main", "legacy.Old", "not_code", "notCode", "middle_main"} {
+		if _, ok := tagIndex.Defines[name]; ok {
+			t.Errorf("Expected %s to be skipped as unclassified", name)
+		}
+	}
+
+	rm := NewRepoMap()
+	for _, path := range []string{"Makefile", "notes.txt"} {
+		if out := rm.renderTree(path, []byte("function notCode() {}\n"), []int{0}); out != "" {
+			t.Errorf("Expected %s not to be rendered, got %q", path, out)
+		}
+	}
+	if out := rm.renderTree("serve", []byte("#!/usr/bin/env python3\ndef serve():\n    pass\n"), []int{1}); !strings.Contains(out, "def serve") {
+		t.Errorf("Expected the Python script to be rendered, got %q", out)
+	}
+}
+
+func TestQueryPredicates(t *testing.T) {
+	t.Cleanup(func() {
+		languages.mu.Lock()
+		defer languages.mu.Unlock()
+		delete(languages.byName, "pyfilter")
+		delete(languages.byExt, "pyf")
+	})
+
+	query := `
+((identifier) @ref
+	(#not-match? @ref "^(self|cls|_)$"))
+((decorated_definition
+	(decorator (identifier) @_decorator)+
+	definition: (function_definition name: (identifier) @def.handler))
+	(#any-eq? @_decorator "route")
+	(#set! kind "endpoint"))
+((function_definition name: (identifier) @def.function)
+	(#not-any-of? @def.function "main" "setup")
+	(#not-match? @def.function "^test_"))
+((function_definition name: (identifier) @def)
+	(#match? @def "^test_")
+	(#set! kind "test"))
+((assignment left: (identifier) @def.alias right: (identifier) @_right)
+	(#not-eq? @def.alias @_right))
+((call function: (identifier) @ref.call)
+	(#any-of? @ref.call "print" "len"))
+`
+	if err := RegisterLanguage("pyfilter", []string{"pyf"}, nil, python.GetLanguage(), query); err != nil {
+		t.Fatalf("Failed to register language: %v", err)
+	}
+
+	tagIndex := generateTags(t, map[string]string{
+		"app.pyf": `def main():
+    self = cls = _ = None
+    print(len(run(self)))
+
+def setup():
+    pass
+
+def test_run():
+    pass
+
+x = x
+y = z
+
+@cached
+@route
+def index():
+    pass
+
+@cached
+def helper():
+    pass
+`,
+	})
+
+	assertDefines(t, tagIndex, "test_run", "y", "index", "helper")
+	assertReferences(t, tagIndex, "print", "len", "run", "z")
+	for _, name := range []string{"main", "setup", "x"} {
+		if _, ok := tagIndex.Defines[name]["app.pyf"]; ok {
+			t.Errorf("Expected %s to be filtered out", name)
+		}
+	}
+	for _, name := range []string{"self", "cls", "_"} {
+		if _, ok := tagIndex.References[name]; ok {
+			t.Errorf("Expected reference to %s to be filtered out", name)
+		}
+	}
+
+	symbolKinds := map[string][]string{
+		"test_run": {"test"},
+		"index":    {"endpoint"},
+		"helper":   {"function"},
+		"y":        {"alias"},
+	}
+	for name, want := range symbolKinds {
+		var got []string
+		for _, tag := range tagIndex.Definitions[filepath.Join("app.pyf", name)] {
+			got = append(got, tag.SymbolKind)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected %s to be tagged as %v, got %v", name, want, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		query   string
+		capture string
+	}{
+		{`((identifier) @ref (#contains? @ref "x"))`, "ref"},
+		{`((identifier) @ref (#match? @ref "["))`, "ref"},
+	} {
+		var qerr *QueryError
+		err := RegisterLanguage("pyfilter", nil, nil, nil, tc.query)
+		if !errors.As(err, &qerr) || qerr.Capture != tc.capture || qerr.Line != 1 {
+			t.Errorf("Expected a QueryError in @%s for %s, got %v", tc.capture, tc.query, err)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
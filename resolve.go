@@ -0,0 +1,549 @@
+// resolve.go
+
+package repomap
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileResolver maps a path named inside a file, such as the argument of a
+// C `#include`, to the indexed files it refers to. fromPath and the returned
+// paths are relative to the index root; known holds every indexed file.
+type fileResolver func(fromPath, spec string, known map[string]struct{}) []string
+
+// resolveInclude resolves a quoted C/C++ include, or a protobuf import,
+// relative to the including file first, then to the repository root, and
+// finally to the indexed file with a matching path suffix, which covers
+// `-Iinclude` style search paths.
+func resolveInclude(fromPath, spec string, known map[string]struct{}) []string {
+	return searchFile(fromPath, spec, known, ".")
+}
+
+// resolveRequire resolves a Ruby `require_relative` argument, which
+// rubyName marks with a leading `./`, against the requiring file's
+// directory, and a `require` argument against the `lib` directories that
+// make up the load path, adding the implied .rb extension. Other requires
+// name gems or the standard library and resolve to nothing.
+func resolveRequire(fromPath, spec string, known map[string]struct{}) []string {
+	if filepath.Ext(spec) == "" {
+		spec += ".rb"
+	}
+	if strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") {
+		path := filepath.Join(filepath.Dir(fromPath), filepath.FromSlash(spec))
+		if _, ok := known[path]; ok {
+			return []string{path}
+		}
+		return nil
+	}
+
+	spec = filepath.Join("lib", filepath.FromSlash(spec))
+	var matches []string
+	for path := range known {
+		if path == spec || strings.HasSuffix(path, string(filepath.Separator)+spec) {
+			matches = append(matches, path)
+		}
+	}
+	// Several gems providing the same file leave it ambiguous
+	if len(matches) != 1 {
+		return nil
+	}
+	return matches
+}
+
+// resolveSource resolves the path given to a shell `source` or `.` command
+// relative to the sourcing script, then to the repository root.
+func resolveSource(fromPath, spec string, known map[string]struct{}) []string {
+	return searchFile(fromPath, spec, known, ".")
+}
+
+// resolveModuleSource resolves the local `source` of a Terraform module to
+// the configuration files in that directory. Registry and remote sources are
+// not indexed and resolve to nothing.
+func resolveModuleSource(fromPath, spec string, known map[string]struct{}) []string {
+	if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+		return nil
+	}
+
+	dir := filepath.Join(filepath.Dir(fromPath), filepath.FromSlash(spec))
+	var files []string
+	for path := range known {
+		if filepath.Dir(path) == dir && filepath.Ext(path) == ".tf" {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// resolveCopySource resolves a Dockerfile COPY or ADD source, which may name
+// a file, a directory or a glob, against the Dockerfile's directory and then
+// the repository root, the two usual build contexts. Sources of a
+// `COPY --from` lie in another stage or image and are not captured at all;
+// absolute paths, URLs and the whole context resolve to nothing.
+func resolveCopySource(fromPath, spec string, known map[string]struct{}) []string {
+	if filepath.IsAbs(spec) || strings.Contains(spec, "://") {
+		return nil
+	}
+	spec = filepath.Clean(filepath.FromSlash(spec))
+	if spec == "." {
+		return nil
+	}
+
+	var files []string
+	for _, root := range []string{filepath.Dir(fromPath), "."} {
+		pattern := filepath.Join(root, spec)
+		for path := range known {
+			if ok, _ := filepath.Match(pattern, path); ok || strings.HasPrefix(path, pattern+string(filepath.Separator)) {
+				files = append(files, path)
+			}
+		}
+		if len(files) > 0 {
+			break
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// searchFile looks spec up relative to the directory of fromPath, then
+// relative to each of roots, and finally as a path suffix of the indexed
+// files. A suffix shared by several files is ambiguous and resolves to
+// nothing.
+func searchFile(fromPath, spec string, known map[string]struct{}, roots ...string) []string {
+	spec = filepath.Clean(filepath.FromSlash(spec))
+
+	candidates := []string{filepath.Join(filepath.Dir(fromPath), spec)}
+	for _, root := range roots {
+		candidates = append(candidates, filepath.Join(root, spec))
+	}
+	for _, candidate := range candidates {
+		if _, ok := known[candidate]; ok {
+			return []string{candidate}
+		}
+	}
+
+	// Parent-relative paths only make sense from the requiring file
+	if strings.HasPrefix(spec, "..") {
+		return nil
+	}
+
+	suffix := string(filepath.Separator) + spec
+	var matches []string
+	for path := range known {
+		if strings.HasSuffix(path, suffix) {
+			matches = append(matches, path)
+		}
+	}
+	if len(matches) != 1 {
+		return nil
+	}
+	return matches
+}
+
+var (
+	headerExts = map[string]struct{}{".h": {}, ".hh": {}, ".hpp": {}, ".hxx": {}}
+	sourceExts = map[string]struct{}{".c": {}, ".cc": {}, ".cpp": {}, ".cxx": {}}
+)
+
+// headerPairs links C/C++ headers with the implementation files sharing
+// their directory and base name, e.g. foo.h and foo.c, in both directions.
+func headerPairs(known map[string]struct{}) map[string][]string {
+	headers := make(map[string][]string)
+	for path := range known {
+		ext := filepath.Ext(path)
+		if _, ok := headerExts[ext]; ok {
+			stem := strings.TrimSuffix(path, ext)
+			headers[stem] = append(headers[stem], path)
+		}
+	}
+
+	pairs := make(map[string][]string)
+	for path := range known {
+		ext := filepath.Ext(path)
+		if _, ok := sourceExts[ext]; !ok {
+			continue
+		}
+		for _, header := range headers[strings.TrimSuffix(path, ext)] {
+			pairs[path] = append(pairs[path], header)
+			pairs[header] = append(pairs[header], path)
+		}
+	}
+	return pairs
+}
+
+// generatedProtoSuffixes identify the files protoc and its common plugins
+// generate from a .proto file; the rest of the name is the .proto's stem.
+var generatedProtoSuffixes = []string{
+	"_grpc.pb.go", ".pb.go", "_pb2_grpc.py", "_pb2.py",
+	"_grpc_pb.js", "_pb.js", "_pb.d.ts", "_pb.ts", ".pb.ts",
+}
+
+// generatedSourceMarkers precede the .proto path in the header comment that
+// code generators write, e.g. `// source: acme/users/v1/user.proto`.
+var generatedSourceMarkers = []string{"// source: ", "# source: ", "@generated from file "}
+
+// generatedHeaderLines bounds how far into a generated file the header
+// comment is looked for.
+const generatedHeaderLines = 30
+
+// protoSources maps each generated protobuf file to the .proto it was
+// generated from, named by its header comment or, failing that, by a .proto
+// sharing its stem. Linking the two lets the schema outrank the generated
+// code that everything else references.
+func protoSources(ti *TagIndex, files map[string][]byte, known map[string]struct{}) map[string]string {
+	sources := make(map[string]string)
+	for path, content := range files {
+		relPath := ti.relPath(path)
+
+		var stem string
+		for _, suffix := range generatedProtoSuffixes {
+			if strings.HasSuffix(relPath, suffix) {
+				stem = strings.TrimSuffix(relPath, suffix)
+				break
+			}
+		}
+		if stem == "" {
+			continue
+		}
+
+		spec := generatedSource(content)
+		if spec == "" {
+			spec = filepath.Base(stem) + ".proto"
+		}
+		if targets := searchFile(relPath, spec, known, "."); len(targets) > 0 {
+			sources[relPath] = targets[0]
+		}
+	}
+	return sources
+}
+
+// generatedSource returns the .proto path recorded in the header of a
+// generated file, if any.
+func generatedSource(content []byte) string {
+	lines := strings.SplitN(string(content), "\n", generatedHeaderLines+1)
+	for i, line := range lines {
+		if i == generatedHeaderLines {
+			break
+		}
+		for _, marker := range generatedSourceMarkers {
+			start := strings.Index(line, marker)
+			if start < 0 {
+				continue
+			}
+			if fields := strings.Fields(line[start+len(marker):]); len(fields) > 0 && strings.HasSuffix(fields[0], ".proto") {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+// goModule is a Go module declared by a go.mod file.
+type goModule struct {
+	path string
+	dir  string
+}
+
+// newGoPackageResolver builds a resolver for Go import paths from the module
+// path of every go.mod among files. An import of a package in one of those
+// modules resolves to the package's non-test source files; other imports
+// resolve to nothing.
+func newGoPackageResolver(ti *TagIndex, files map[string][]byte) fileResolver {
+	var modules []goModule
+	for path, content := range files {
+		if filepath.Base(path) != "go.mod" {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			line, _, _ = strings.Cut(line, "//")
+			if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+				modules = append(modules, goModule{
+					path: strings.Trim(fields[1], `"`),
+					dir:  filepath.Dir(ti.relPath(path)),
+				})
+				break
+			}
+		}
+	}
+
+	// Nested modules take precedence over the modules enclosing them
+	sort.Slice(modules, func(i, j int) bool { return len(modules[i].path) > len(modules[j].path) })
+
+	return func(fromPath, spec string, known map[string]struct{}) []string {
+		for _, module := range modules {
+			if spec != module.path && !strings.HasPrefix(spec, module.path+"/") {
+				continue
+			}
+			dir := filepath.Join(module.dir, filepath.FromSlash(strings.TrimPrefix(spec, module.path)))
+
+			var files []string
+			for path := range known {
+				if filepath.Dir(path) == dir && filepath.Ext(path) == ".go" && !strings.HasSuffix(path, "_test.go") {
+					files = append(files, path)
+				}
+			}
+			sort.Strings(files)
+			return files
+		}
+		return nil
+	}
+}
+
+// tsconfig is the subset of tsconfig.json or jsconfig.json needed to resolve
+// non-relative module specifiers.
+type tsconfig struct {
+	CompilerOptions struct {
+		BaseURL string              `json:"baseUrl"`
+		Paths   map[string][]string `json:"paths"`
+	} `json:"compilerOptions"`
+}
+
+// moduleConfig is a parsed tsconfig with its directories made relative to
+// the index root. baseURL is empty unless the config sets one; `paths`
+// targets are relative to it, or to dir without it.
+type moduleConfig struct {
+	dir     string
+	baseURL string
+	paths   map[string][]string
+}
+
+// moduleExts are the extensions tried, in order, for an extensionless
+// import specifier and for the index file of a directory.
+var moduleExts = []string{".ts", ".tsx", ".d.ts", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs"}
+
+// compiledExts maps the extensions ES module imports name to the TypeScript
+// sources compiled into them, as in `import "./user.js"` for user.ts.
+var compiledExts = map[string][]string{
+	".js":  {".ts", ".tsx"},
+	".jsx": {".tsx"},
+	".mjs": {".mts"},
+	".cjs": {".cts"},
+}
+
+// newModuleResolver builds a resolver for JavaScript and TypeScript import
+// specifiers. Relative specifiers resolve against the importing file; others
+// go through the `paths` and `baseUrl` of the nearest tsconfig.json or
+// jsconfig.json. Packages from node_modules resolve to nothing.
+func newModuleResolver(ti *TagIndex, files map[string][]byte) fileResolver {
+	var configs []moduleConfig
+	for path, content := range files {
+		if base := filepath.Base(path); base != "tsconfig.json" && base != "jsconfig.json" {
+			continue
+		}
+
+		var config tsconfig
+		if err := json.Unmarshal(stripJSONComments(content), &config); err != nil {
+			continue
+		}
+
+		dir := filepath.Dir(ti.relPath(path))
+		var baseURL string
+		if config.CompilerOptions.BaseURL != "" {
+			baseURL = filepath.Join(dir, filepath.FromSlash(config.CompilerOptions.BaseURL))
+		}
+		configs = append(configs, moduleConfig{dir: dir, baseURL: baseURL, paths: config.CompilerOptions.Paths})
+	}
+
+	// The deepest config enclosing a file applies to it
+	sort.Slice(configs, func(i, j int) bool { return len(configs[i].dir) > len(configs[j].dir) })
+
+	return func(fromPath, spec string, known map[string]struct{}) []string {
+		if strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") {
+			return resolveModulePath(filepath.Join(filepath.Dir(fromPath), filepath.FromSlash(spec)), known)
+		}
+
+		for _, config := range configs {
+			if config.dir != "." && !strings.HasPrefix(fromPath, config.dir+string(filepath.Separator)) {
+				continue
+			}
+			for _, target := range config.pathTargets(spec) {
+				if resolved := resolveModulePath(target, known); resolved != nil {
+					return resolved
+				}
+			}
+			if config.baseURL == "" {
+				return nil
+			}
+			return resolveModulePath(filepath.Join(config.baseURL, filepath.FromSlash(spec)), known)
+		}
+		return nil
+	}
+}
+
+// pathTargets returns the candidate paths of spec under the config's
+// `paths` mappings, most specific pattern first.
+func (c moduleConfig) pathTargets(spec string) []string {
+	patterns := make([]string, 0, len(c.paths))
+	for pattern := range c.paths {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+
+	root := c.baseURL
+	if root == "" {
+		root = c.dir
+	}
+
+	var targets []string
+	for _, pattern := range patterns {
+		var wildcard string
+		if prefix, suffix, ok := strings.Cut(pattern, "*"); ok {
+			if !strings.HasPrefix(spec, prefix) || !strings.HasSuffix(spec, suffix) || len(spec) < len(prefix)+len(suffix) {
+				continue
+			}
+			wildcard = spec[len(prefix) : len(spec)-len(suffix)]
+		} else if pattern != spec {
+			continue
+		}
+
+		for _, target := range c.paths[pattern] {
+			target = strings.Replace(target, "*", wildcard, 1)
+			targets = append(targets, filepath.Join(root, filepath.FromSlash(target)))
+		}
+	}
+	return targets
+}
+
+// resolveModulePath resolves an import to an indexed file the way bundlers
+// do: the path itself, with a source extension added, a TypeScript source
+// behind a compiled extension, or a directory's index file.
+func resolveModulePath(path string, known map[string]struct{}) []string {
+	candidates := []string{path}
+	for _, ext := range moduleExts {
+		candidates = append(candidates, path+ext)
+	}
+	ext := filepath.Ext(path)
+	for _, sourceExt := range compiledExts[ext] {
+		candidates = append(candidates, strings.TrimSuffix(path, ext)+sourceExt)
+	}
+	for _, ext := range moduleExts {
+		candidates = append(candidates, filepath.Join(path, "index"+ext))
+	}
+
+	for _, candidate := range candidates {
+		if _, ok := known[candidate]; ok {
+			return []string{candidate}
+		}
+	}
+	return nil
+}
+
+// stripJSONComments removes the comments and trailing commas that
+// tsconfig.json allows but encoding/json does not.
+func stripJSONComments(content []byte) []byte {
+	var out []byte
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				out = append(out, content[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			if i < len(content) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		case c == '}' || c == ']':
+			// Drop a trailing comma before the closing bracket
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out = append(trimmed[:len(trimmed)-1], out[len(trimmed):]...)
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// composerManifest is the subset of composer.json needed for PSR-4 lookups.
+type composerManifest struct {
+	Autoload    composerAutoload `json:"autoload"`
+	AutoloadDev composerAutoload `json:"autoload-dev"`
+}
+
+type composerAutoload struct {
+	// PSR4 maps a namespace prefix to one directory or a list of them
+	PSR4 map[string]json.RawMessage `json:"psr-4"`
+}
+
+// psr4Rule maps a namespace prefix to a directory relative to the index root.
+type psr4Rule struct {
+	prefix string
+	dir    string
+}
+
+// newPSR4Resolver builds a resolver for PHP `use` statements from the PSR-4
+// autoload rules of every composer.json among files. Longer prefixes win, as
+// they do in Composer's autoloader.
+func newPSR4Resolver(ti *TagIndex, files map[string][]byte) fileResolver {
+	var rules []psr4Rule
+	for path, content := range files {
+		if filepath.Base(path) != "composer.json" {
+			continue
+		}
+
+		var manifest composerManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			continue
+		}
+
+		root := filepath.Dir(ti.relPath(path))
+		for _, autoload := range []composerAutoload{manifest.Autoload, manifest.AutoloadDev} {
+			for prefix, raw := range autoload.PSR4 {
+				var dirs []string
+				var dir string
+				if err := json.Unmarshal(raw, &dir); err == nil {
+					dirs = []string{dir}
+				} else if err := json.Unmarshal(raw, &dirs); err != nil {
+					continue
+				}
+				for _, dir := range dirs {
+					rules = append(rules, psr4Rule{
+						prefix: strings.TrimPrefix(prefix, "\\"),
+						dir:    filepath.Join(root, filepath.FromSlash(dir)),
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return len(rules[i].prefix) > len(rules[j].prefix) })
+
+	return func(fromPath, spec string, known map[string]struct{}) []string {
+		class := strings.TrimPrefix(spec, "\\")
+		for _, rule := range rules {
+			if !strings.HasPrefix(class, rule.prefix) {
+				continue
+			}
+			rest := strings.ReplaceAll(strings.TrimPrefix(class, rule.prefix), "\\", string(filepath.Separator))
+			candidate := filepath.Join(rule.dir, rest+".php")
+			if _, ok := known[candidate]; ok {
+				return []string{candidate}
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,618 @@
+// scope.go
+
+package repomap
+
+import (
+	"path/filepath"
+	"strings"
+
+	tree_sitter "github.com/smacker/go-tree-sitter"
+)
+
+// scopeSpec describes the enclosing nodes that qualify a definition's name,
+// so that e.g. two `new` methods on different Rust types do not collapse into
+// a single identifier.
+type scopeSpec struct {
+	// Nodes maps a scope node type to the field holding its name. Grammars
+	// without fields, such as Kotlin, name the type of the child instead.
+	Nodes     map[string]string
+	Separator string
+	// PackageSeparator joins the file's package to the rest of the name when
+	// it differs from Separator, as with PHP's `App\Models\User::find`.
+	PackageSeparator string
+	// Macros restricts scope nodes to calls of the named macros, for grammars
+	// such as Elixir's where every declaration is a generic call.
+	Macros map[string]struct{}
+}
+
+var goScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"type_spec":          "name",
+		"method_declaration": "receiver",
+	},
+	Separator: ".",
+}
+
+var rustScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"mod_item":   "name",
+		"trait_item": "name",
+		"impl_item":  "type",
+	},
+	Separator: "::",
+}
+
+var javaScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"class_declaration":           "name",
+		"interface_declaration":       "name",
+		"enum_declaration":            "name",
+		"record_declaration":          "name",
+		"annotation_type_declaration": "name",
+	},
+	Separator: ".",
+}
+
+var kotlinScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"class_declaration":  "type_identifier",
+		"object_declaration": "type_identifier",
+	},
+	Separator: ".",
+}
+
+var cppScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"namespace_definition": "name",
+		"class_specifier":      "name",
+		"struct_specifier":     "name",
+	},
+	Separator: "::",
+}
+
+var csharpScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"namespace_declaration": "name",
+		"class_declaration":     "name",
+		"interface_declaration": "name",
+		"struct_declaration":    "name",
+		"record_declaration":    "name",
+	},
+	Separator: ".",
+}
+
+var phpScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"class_declaration":     "name",
+		"interface_declaration": "name",
+		"trait_declaration":     "name",
+		"enum_declaration":      "name",
+	},
+	Separator:        "::",
+	PackageSeparator: "\\",
+}
+
+var rubyScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"module": "name",
+		"class":  "name",
+	},
+	Separator: "::",
+}
+
+var swiftScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"class_declaration":    "name",
+		"protocol_declaration": "name",
+	},
+	Separator: ".",
+}
+
+var scalaScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"class_definition":  "name",
+		"object_definition": "name",
+		"trait_definition":  "name",
+		"enum_definition":   "name",
+	},
+	Separator: ".",
+}
+
+var groovyScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"class_definition": "name",
+	},
+	Separator: ".",
+}
+
+var elixirScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"call": "arguments",
+	},
+	Separator: ".",
+	Macros:    map[string]struct{}{"defmodule": {}},
+}
+
+var ocamlScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"module_binding":         "name",
+		"module_type_definition": "name",
+	},
+	Separator: ".",
+}
+
+var protoScopes = &scopeSpec{
+	Nodes: map[string]string{
+		"message": "message_name",
+		"enum":    "enum_name",
+		"service": "service_name",
+	},
+	Separator: ".",
+}
+
+// csharpSplitType reports whether a C# definition may be part of a
+// `partial` type: a class, struct, interface or record, but never the
+// namespace every file of a project opens.
+func csharpSplitType(node *tree_sitter.Node, kind string) bool {
+	switch kind {
+	case "class", "struct", "interface", "record":
+		return true
+	}
+	return false
+}
+
+// cppSplitType reports whether a C++ definition may be spread across files:
+// a type, or a member defined out of line from its class.
+func cppSplitType(node *tree_sitter.Node, kind string) bool {
+	switch kind {
+	case "class", "struct", "union", "method", "function":
+		return true
+	}
+	return false
+}
+
+// rustSplitType reports whether a Rust definition is a member of an `impl`
+// block, which may live in another module than its type.
+func rustSplitType(node *tree_sitter.Node, kind string) bool {
+	if kind != "function" {
+		return false
+	}
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Type() == "impl_item" {
+			return true
+		}
+	}
+	return false
+}
+
+// nameFunc returns the names a capture stands for, derived from the syntax
+// around it, for languages that spread one identifier over several nodes or
+// pack several into one. An empty result drops the capture.
+type nameFunc func(node *tree_sitter.Node, name string, content []byte) []string
+
+// hclAddressParts is the number of attributes following each Terraform
+// reference root that belong to the address, e.g. `var.region`.
+var hclAddressParts = map[string]int{
+	"var":    1,
+	"local":  1,
+	"module": 1,
+	"data":   2,
+}
+
+// hclAddress names Terraform blocks and the expressions referring to them by
+// their address, such as `aws_s3_bucket.logs`, `data.aws_iam_policy.ro`,
+// `module.network` or `var.region`, so both sides of a reference agree.
+func hclAddress(node *tree_sitter.Node, name string, content []byte) []string {
+	parent := node.Parent()
+	if parent == nil {
+		return []string{name}
+	}
+
+	switch parent.Type() {
+	case "block":
+		var labels []string
+		for i := 0; i < int(parent.NamedChildCount()); i++ {
+			if child := parent.NamedChild(i); child.Type() == "string_lit" {
+				labels = append(labels, captureName(child, content))
+			}
+		}
+		if len(labels) == 0 {
+			return []string{name}
+		}
+		switch name {
+		case "resource":
+			return []string{strings.Join(labels, ".")}
+		case "data":
+			return []string{"data." + strings.Join(labels, ".")}
+		case "variable":
+			return []string{"var." + labels[0]}
+		default:
+			return []string{name + "." + labels[0]}
+		}
+
+	case "attribute":
+		// Only attributes of a locals block are captured
+		return []string{"local." + name}
+
+	case "variable_expr":
+		parts, ok := hclAddressParts[name]
+		if !ok {
+			// Any other root is a resource type followed by its name
+			parts = 1
+		}
+		address := []string{name}
+		for sibling := parent.NextNamedSibling(); sibling != nil && len(address) <= parts; sibling = sibling.NextNamedSibling() {
+			if sibling.Type() != "get_attr" || sibling.NamedChildCount() == 0 {
+				break
+			}
+			address = append(address, sibling.NamedChild(0).Content(content))
+		}
+		if len(address) <= parts {
+			return []string{name}
+		}
+		return []string{strings.Join(address, ".")}
+	}
+	return []string{name}
+}
+
+// goPackageDir names the package of a Go file by its directory, which,
+// unlike the package clause, tells apart two `server` packages. Files at the
+// root of the index are left unqualified.
+func goPackageDir(relPath string) string {
+	dir := filepath.ToSlash(filepath.Dir(relPath))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// ocamlModule names the module a file defines after its base name, so that
+// the `get_user` of accounts.ml is `Accounts.get_user`.
+func ocamlModule(relPath string) string {
+	name := strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath))
+	if name == "" {
+		return ""
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// rubyName marks the argument of a `require_relative` call as a relative
+// path, so that resolveRequire tells it apart from a `require`.
+func rubyName(node *tree_sitter.Node, name string, content []byte) []string {
+	if node.Type() != "string_content" || strings.HasPrefix(name, ".") {
+		return []string{name}
+	}
+	call := node.Parent()
+	for call != nil && call.Type() != "call" {
+		call = call.Parent()
+	}
+	if call == nil {
+		return []string{name}
+	}
+	if method := call.ChildByFieldName("method"); method != nil && method.Content(content) == "require_relative" {
+		return []string{"./" + name}
+	}
+	return []string{name}
+}
+
+// hclModuleName prefixes the input variables and locals of a Terraform
+// module with its directory, as in `modules/net/var.region`, since only the
+// module's own files see them. Files at the root of the index are left
+// unqualified.
+func hclModuleName(relPath, name string) string {
+	if !strings.HasPrefix(name, "var.") && !strings.HasPrefix(name, "local.") {
+		return name
+	}
+	dir := filepath.ToSlash(filepath.Dir(relPath))
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// dockerfileName reduces a `COPY --from=builder` flag to the stage it names.
+func dockerfileName(node *tree_sitter.Node, name string, content []byte) []string {
+	if node.Type() == "param" {
+		if _, stage, ok := strings.Cut(name, "="); ok {
+			return []string{stage}
+		}
+	}
+	return []string{name}
+}
+
+// selectorNames names CSS class and id selectors, and the class and id
+// attributes of markup referring to them, in selector syntax, e.g. `.btn`
+// and `#main`, so they stay apart from code identifiers. A class attribute
+// stands for each class it lists.
+func selectorNames(node *tree_sitter.Node, name string, content []byte) []string {
+	switch node.Type() {
+	case "class_name":
+		return []string{"." + name}
+	case "id_name":
+		return []string{"#" + name}
+	case "attribute_value", "string_fragment":
+		// Attribute values are named after the attribute below
+	default:
+		return []string{name}
+	}
+
+	var attr string
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Type() == "attribute" || parent.Type() == "jsx_attribute" {
+			if parent.NamedChildCount() > 0 {
+				attr = parent.NamedChild(0).Content(content)
+			}
+			break
+		}
+	}
+
+	switch attr {
+	case "class", "className":
+		var names []string
+		for _, class := range strings.Fields(withoutExpressions(name)) {
+			names = append(names, "."+class)
+		}
+		return names
+	case "id":
+		return []string{"#" + name}
+	}
+	return []string{name}
+}
+
+// withoutExpressions blanks out the `{…}` expressions of an attribute value,
+// as in Svelte's `class="btn {active ? 'on' : 'off'}"`, leaving its literal
+// text.
+func withoutExpressions(value string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range value {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteByte(' ')
+			}
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// yamlRefKinds maps the keys Kubernetes objects use to refer to one another
+// by name to the kind of object referred to.
+var yamlRefKinds = map[string]string{
+	"configMapRef":    "ConfigMap",
+	"configMapKeyRef": "ConfigMap",
+	"configMap":       "ConfigMap",
+	"secretRef":       "Secret",
+	"secretKeyRef":    "Secret",
+	"secretName":      "Secret",
+	"service":         "Service",
+	"serviceName":     "Service",
+	"claimName":       "PersistentVolumeClaim",
+}
+
+// yamlName names Kubernetes objects and references to them by kind and
+// name, e.g. `ConfigMap/web-config`, and drops the top-level keys of
+// Kubernetes manifests and Compose files, which only stand in for the
+// definitions of generic YAML documents.
+func yamlName(node *tree_sitter.Node, name string, content []byte) []string {
+	pair := node.Parent()
+	if pair == nil || pair.Type() != "block_mapping_pair" && pair.Type() != "flow_pair" {
+		return []string{name}
+	}
+	key := pair.ChildByFieldName("key")
+	if key == nil {
+		return []string{name}
+	}
+	parent := yamlParentPair(pair)
+
+	if key.Equal(node) {
+		if parent == nil && (yamlSibling(pair, "kind", content) != nil || yamlSibling(pair, "services", content) != nil) {
+			return nil
+		}
+		return []string{name}
+	}
+
+	keyName := key.Content(content)
+	if keyName == "name" && parent != nil {
+		if parentKey := parent.ChildByFieldName("key"); parentKey != nil {
+			keyName = parentKey.Content(content)
+		}
+		if keyName == "metadata" {
+			kind := yamlSibling(parent, "kind", content)
+			if kind == nil || kind.ChildByFieldName("value") == nil {
+				return nil
+			}
+			return []string{kind.ChildByFieldName("value").Content(content) + "/" + name}
+		}
+	}
+	if kind, ok := yamlRefKinds[keyName]; ok {
+		return []string{kind + "/" + name}
+	}
+	return []string{name}
+}
+
+// yamlParentPair returns the mapping pair whose value holds pair, or nil at
+// the top level of a document or of a sequence item.
+func yamlParentPair(pair *tree_sitter.Node) *tree_sitter.Node {
+	for parent := pair.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.Type() {
+		case "block_mapping_pair", "flow_pair":
+			return parent
+		case "document", "block_sequence_item", "flow_sequence":
+			return nil
+		}
+	}
+	return nil
+}
+
+// yamlSibling returns the pair in the same mapping as pair with the given key.
+func yamlSibling(pair *tree_sitter.Node, key string, content []byte) *tree_sitter.Node {
+	mapping := pair.Parent()
+	if mapping == nil {
+		return nil
+	}
+	for i := 0; i < int(mapping.NamedChildCount()); i++ {
+		sibling := mapping.NamedChild(i)
+		if siblingKey := sibling.ChildByFieldName("key"); siblingKey != nil && siblingKey.Content(content) == key {
+			return sibling
+		}
+	}
+	return nil
+}
+
+// qualifiedSeparators are the separators recognised between the segments of
+// a qualified name.
+var qualifiedSeparators = []string{"::", ".", "\\"}
+
+// qualify prefixes name with the file's package, if any, followed by the
+// names of all scopes enclosing node, outermost first.
+func (s *scopeSpec) qualify(pkg string, node *tree_sitter.Node, name string, content []byte) string {
+	if s == nil {
+		if pkg == "" {
+			return name
+		}
+		return pkg + "." + name
+	}
+
+	var scopes []string
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		field, ok := s.Nodes[parent.Type()]
+		if !ok || !s.isMacroScope(parent, content) {
+			continue
+		}
+
+		nameNode := scopeNameNode(parent, field)
+		// A definition is not qualified by its own declaration
+		if nameNode == nil || encloses(nameNode, node) {
+			continue
+		}
+
+		scopeName := scopeNodeName(nameNode, content)
+		if scopeName != "" {
+			scopes = append(scopes, scopeName)
+		}
+	}
+
+	// Scopes were collected innermost first
+	for i, j := 0, len(scopes)-1; i < j; i, j = i+1, j-1 {
+		scopes[i], scopes[j] = scopes[j], scopes[i]
+	}
+	qualified := strings.Join(append(scopes, name), s.Separator)
+
+	if pkg == "" {
+		return qualified
+	}
+	if s.PackageSeparator != "" {
+		return pkg + s.PackageSeparator + qualified
+	}
+	return pkg + s.Separator + qualified
+}
+
+// isMacroScope reports whether node opens a scope under s.Macros, which
+// always holds when no macros are configured.
+func (s *scopeSpec) isMacroScope(node *tree_sitter.Node, content []byte) bool {
+	if s.Macros == nil {
+		return true
+	}
+	target := node.ChildByFieldName("target")
+	if target == nil {
+		return false
+	}
+	_, ok := s.Macros[target.Content(content)]
+	return ok
+}
+
+// encloses reports whether inner lies within outer.
+func encloses(outer, inner *tree_sitter.Node) bool {
+	return outer.StartByte() <= inner.StartByte() && inner.EndByte() <= outer.EndByte()
+}
+
+// scopeNameNode returns the child of node holding its name, looked up by
+// field first and by node type otherwise.
+func scopeNameNode(node *tree_sitter.Node, field string) *tree_sitter.Node {
+	if child := node.ChildByFieldName(field); child != nil {
+		return child
+	}
+
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		if child.Type() == field {
+			return child
+		}
+	}
+	return nil
+}
+
+// scopeNodeName returns the text of a scope's name node with any generic
+// arguments (`Repo<T>`) stripped. A Go receiver list names the receiver's
+// type.
+func scopeNodeName(node *tree_sitter.Node, content []byte) string {
+	if node.Type() == "parameter_list" {
+		node = firstOfType(node, "type_identifier")
+		if node == nil {
+			return ""
+		}
+	}
+
+	name := node.Content(content)
+	if i := strings.Index(name, "<"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(name)
+}
+
+// firstOfType returns the first node of the given type in a depth-first walk
+// of node's named descendants.
+func firstOfType(node *tree_sitter.Node, nodeType string) *tree_sitter.Node {
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		if child.Type() == nodeType {
+			return child
+		}
+		if found := firstOfType(child, nodeType); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// shortName returns the last segment of a qualified name. CSS selectors are
+// never split.
+func shortName(name string) string {
+	if isSelectorName(name) {
+		return name
+	}
+	for _, sep := range qualifiedSeparators {
+		if i := strings.LastIndex(name, sep); i >= 0 && i < len(name)-len(sep) {
+			name = name[i+len(sep):]
+		}
+	}
+	return name
+}
+
+// hasQualifiedSuffix reports whether name ends with suffix on a scope
+// boundary, e.g. `crate::models::User` ends with `User`.
+func hasQualifiedSuffix(name, suffix string) bool {
+	if isSelectorName(name) || isSelectorName(suffix) || !strings.HasSuffix(name, suffix) {
+		return false
+	}
+	prefix := strings.TrimSuffix(name, suffix)
+	for _, sep := range qualifiedSeparators {
+		if strings.HasSuffix(prefix, sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSelectorName reports whether name is a CSS selector such as `.btn` or
+// `#main`, whose dot does not separate scopes: `.active` is no qualified
+// form of an `active` variable.
+func isSelectorName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#")
+}
@@ -4,6 +4,7 @@ package repomap
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,6 +20,9 @@ type Tag struct {
 	Line     int
 	Name     string
 	Kind     TagKind
+	// SymbolKind is what the tag names, such as function or class, as given
+	// by its query capture or a `#set! kind` directive
+	SymbolKind string
 }
 
 // String implements the Stringer interface for Tag
@@ -44,14 +48,35 @@ func (k TagKind) String() string {
 	}
 }
 
+// capturedNode identifies a tag taken from a query capture within a single
+// file; one capture may stand for several names.
+type capturedNode struct {
+	start, end uint32
+	kind       TagKind
+	name       string
+}
+
+// capturedTag locates the tag of a captured node among a file's tags,
+// together with the query pattern it was taken from.
+type capturedTag struct {
+	index   int
+	pattern uint16
+}
+
 type TagIndex struct {
 	Defines     map[string]map[string]struct{}
 	References  map[string][]string
 	Definitions map[string][]Tag
 	CommonTags  map[string]struct{}
 	FileToTags  map[string]map[string]struct{}
-	Path        string
-	mu          sync.Mutex
+	// FileEdges holds explicit file-to-file dependencies such as C
+	// `#include` directives, keyed by the depending file.
+	FileEdges map[string]map[string]struct{}
+	Path      string
+	// splitTypes holds the qualified type definitions that may be spread
+	// across files
+	splitTypes map[string]struct{}
+	mu         sync.Mutex
 }
 
 func NewTagIndex(path string) *TagIndex {
@@ -61,7 +86,9 @@ func NewTagIndex(path string) *TagIndex {
 		Definitions: make(map[string][]Tag),
 		CommonTags:  make(map[string]struct{}),
 		FileToTags:  make(map[string]map[string]struct{}),
+		FileEdges:   make(map[string]map[string]struct{}),
 		Path:        path,
+		splitTypes:  make(map[string]struct{}),
 	}
 }
 
@@ -84,122 +111,365 @@ func (ti *TagIndex) GetFiles(dir string) (map[string][]byte, error) {
 	return files, err
 }
 
-// Query patterns for different languages
-const (
-	goQuery = `
-		(function_declaration 
-			name: (identifier) @def.function)
-		(method_declaration 
-			receiver: (parameter_list) @method.receiver
-			name: (field_identifier) @def.method)
-		(type_declaration 
-			(type_spec 
-				name: (type_identifier) @def.type))
-		(identifier) @ref.ident
-		(field_identifier) @ref.field
-	`
-	jsQuery = `
-		(function_declaration 
-			name: (identifier) @def.function)
-		(method_definition 
-			name: (property_identifier) @def.method)
-		(class_declaration 
-			name: (identifier) @def.class)
-		(identifier) @ref.ident
-		(property_identifier) @ref.prop
-	`
-)
-
-// GenerateFromFiles generates tags from the given files
+// GenerateFromFiles generates tags from the given files. Languages whose
+// query fails to compile are skipped, and reported as *QueryError values in
+// the returned error once the other files are indexed.
 func (ti *TagIndex) GenerateFromFiles(ctx context.Context, files map[string][]byte) error {
 	ti.mu.Lock()
 	defer ti.mu.Unlock()
 
+	// Files that explicit file edges may resolve to
+	known := make(map[string]struct{}, len(files))
+	for path := range files {
+		known[ti.relPath(path)] = struct{}{}
+	}
+
+	e := &extractor{
+		ti:         ti,
+		known:      known,
+		psr4:       newPSR4Resolver(ti, files),
+		modules:    newModuleResolver(ti, files),
+		goPackages: newGoPackageResolver(ti, files),
+		queries:    make(map[*language]*tagsQuery),
+	}
+	attributes := make(map[string][]byte)
 	for path, content := range files {
-		// Skip non-source files
-		ext := filepath.Ext(path)
-		if _, ok := tsLanguages[strings.TrimPrefix(ext, ".")]; !ok {
-			continue
+		if filepath.Base(path) == ".gitattributes" {
+			attributes[path] = content
 		}
+	}
+	detector := newLanguageDetector(attributes)
 
-		parser := tree_sitter.NewParser()
-		lang := tsLanguages[strings.TrimPrefix(ext, ".")]
-		parser.SetLanguage(lang)
+	for path, content := range files {
+		var fileTags []Tag
+		var err error
 
-		tree, err := parser.ParseCtx(ctx, nil, content)
+		if strings.EqualFold(filepath.Ext(path), ".ipynb") {
+			fileTags, err = e.extractNotebook(ctx, path, content)
+		} else if lang := detector.detect(path, content); lang != nil {
+			fileTags, err = e.extract(ctx, path, lang, content, nil)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to parse %s: %w", path, err)
+			return err
 		}
+		ti.addFileTags(fileTags, ti.relPath(path))
+	}
 
-		// Select query based on file extension
-		var queryStr string
-		switch strings.TrimPrefix(ext, ".") {
-		case "go":
-			queryStr = goQuery
-		case "js", "ts", "jsx", "tsx":
-			queryStr = jsQuery
-		default:
-			continue
+	for path, targets := range headerPairs(known) {
+		for _, target := range targets {
+			ti.AddFileEdge(path, target)
 		}
+	}
+	for path, source := range protoSources(ti, files, known) {
+		ti.AddFileEdge(path, source)
+	}
 
-		query, err := tree_sitter.NewQuery([]byte(queryStr), lang)
-		if err != nil {
-			return fmt.Errorf("failed to create query for %s: %w", path, err)
-		}
+	// Process tags after all files have been processed
+	ti.PostProcessTags()
+
+	return errors.Join(e.errs...)
+}
 
-		cursor := tree_sitter.NewQueryCursor()
-		cursor.Exec(query, tree.RootNode())
+// extractor carries the state shared by every file of a GenerateFromFiles run.
+type extractor struct {
+	ti    *TagIndex
+	known map[string]struct{}
+	psr4  fileResolver
+	// goPackages resolves Go import paths within the indexed modules
+	goPackages fileResolver
+	// modules resolves JavaScript and TypeScript import specifiers
+	modules fileResolver
+	// queries caches each registered language's compiled query
+	queries map[*language]*tagsQuery
+	// errs holds the queries that failed to compile
+	errs []error
+}
 
-		// Make path relative to the index path
-		relPath, err := filepath.Rel(ti.Path, path)
-		if err != nil {
-			relPath = path
+// injection is a range of a file to extract with another language.
+type injection struct {
+	name string
+	rng  tree_sitter.Range
+}
+
+// extract returns the tags of the file at path, parsed as lang. When ranges
+// is set only those parts of content are parsed, so that tags of embedded
+// code keep the host file's positions. Nodes captured as
+// `@injection.<language>`, or as `@injection.content` next to an
+// `@injection.language` naming the language, are extracted the same way in
+// turn, each on its own.
+func (e *extractor) extract(ctx context.Context, path string, lang *language, content []byte, ranges []tree_sitter.Range) ([]Tag, error) {
+	if lang.query == "" {
+		return nil, nil
+	}
+
+	parser := tree_sitter.NewParser()
+	parser.SetLanguage(lang.grammar)
+	if ranges != nil {
+		parser.SetIncludedRanges(ranges)
+	}
+
+	tree, err := parser.ParseCtx(ctx, nil, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	query, ok := e.queries[lang]
+	if !ok {
+		var qerr *QueryError
+		query, qerr = compileQuery(lang.grammar, lang.query, 0)
+		if qerr != nil {
+			// Reported once, after the files of other languages are indexed
+			qerr.Language = lang.name
+			e.errs = append(e.errs, qerr)
 		}
+		e.queries[lang] = query
+	}
+	if query == nil {
+		return nil, nil
+	}
+
+	var resolver fileResolver
+	if lang.resolver != nil {
+		resolver = lang.resolver(e)
+	}
+
+	cursor := tree_sitter.NewQueryCursor()
+	cursor.Exec(query.Query, tree.RootNode())
 
-		for {
-			match, ok := cursor.NextMatch()
-			if !ok {
-				break
+	relPath := e.ti.relPath(path)
+
+	// Several patterns may capture the same node; tag it only once
+	seen := make(map[capturedNode]capturedTag)
+	var fileTags []Tag
+	// Package or namespace declared at the top of the file
+	var pkg string
+	// Embedded code does not belong to the host file's package
+	if lang.filePackage != nil && ranges == nil {
+		pkg = lang.filePackage(relPath)
+	}
+	// Embedded code to extract with another language
+	var injections []injection
+
+	for {
+		match, ok := cursor.NextMatch()
+		if !ok {
+			break
+		}
+		pattern := &query.patterns[match.PatternIndex]
+		if !pattern.matches(query.Query, match, content) {
+			continue
+		}
+		// tags.scm patterns capture a whole definition and its name apart
+		nameNode := matchNameNode(query.Query, match)
+
+		for _, capture := range match.Captures {
+			patternName := query.CaptureNameForId(capture.Index)
+			// The symbol kind, such as function in @def.function
+			kind, symbolKind, _ := strings.Cut(patternName, ".")
+			switch kind {
+			case "definition":
+				kind = "def"
+			case "reference":
+				kind = "ref"
 			}
 
-			for _, capture := range match.Captures {
-				patternName := query.CaptureNameForId(capture.Index)
-				parts := strings.SplitN(patternName, ".", 2)
-				if len(parts) != 2 {
-					continue
+			if kind == "injection" {
+				injected := symbolKind
+				if injected == "content" {
+					injected = injectionLanguage(query.Query, match, content)
+				}
+				if injected != "language" {
+					injections = append(injections, injection{injected, nodeRange(capture.Node)})
 				}
+				continue
+			}
+			if kind != "def" && kind != "ref" && kind != "package" && kind != "file" {
+				continue
+			}
+			if value, ok := pattern.properties["kind"]; ok {
+				symbolKind = value
+			}
+
+			node := capture.Node
+			if nameNode != nil {
+				node = nameNode
+			}
 
-				kind := parts[0]
-				name := string(capture.Node.Content(content))
+			names := []string{captureName(node, content)}
+			if lang.namer != nil {
+				names = lang.namer(node, names[0], content)
+			}
 
+			for _, name := range names {
 				// Skip empty names and special characters
 				if name == "" || strings.ContainsAny(name, "()[]{}") {
 					continue
 				}
 
+				if kind == "package" {
+					pkg = name
+					continue
+				}
+
+				if kind == "file" {
+					if resolver != nil {
+						for _, target := range resolver(relPath, name, e.known) {
+							e.ti.AddFileEdge(relPath, target)
+						}
+					}
+					continue
+				}
+
+				if lang.moduleName != nil && ranges == nil {
+					name = lang.moduleName(relPath, name)
+				}
+
 				tag := Tag{
-					RelFname: relPath,
-					Fname:    path,
-					Line:     int(capture.Node.StartPoint().Row) + 1, // Convert to 1-based line numbers
-					Name:     name,
-					Kind:     Definition,
+					RelFname:   relPath,
+					Fname:      path,
+					Line:       int(node.StartPoint().Row) + 1, // Convert to 1-based line numbers
+					Name:       name,
+					Kind:       Definition,
+					SymbolKind: symbolKind,
 				}
 
 				if kind == "ref" {
 					tag.Kind = Reference
+				} else {
+					tag.Name = lang.scopes.qualify(pkg, node, name, content)
+					if lang.splitType != nil && shortName(tag.Name) != tag.Name && lang.splitType(node, symbolKind) {
+						e.ti.splitTypes[tag.Name] = struct{}{}
+					}
 				}
 
-				ti.AddTag(tag, relPath)
+				// The pattern listed first in the query sets the symbol kind
+				key := capturedNode{node.StartByte(), node.EndByte(), tag.Kind, tag.Name}
+				if prev, ok := seen[key]; ok {
+					if match.PatternIndex < prev.pattern {
+						fileTags[prev.index].SymbolKind = tag.SymbolKind
+						seen[key] = capturedTag{prev.index, match.PatternIndex}
+					}
+					continue
+				}
+				seen[key] = capturedTag{len(fileTags), match.PatternIndex}
+
+				fileTags = append(fileTags, tag)
 			}
 		}
 	}
 
-	// Process tags after all files have been processed
-	ti.PostProcessTags()
+	for _, inj := range injections {
+		injected := languageFor(inj.name)
+		if injected == nil {
+			continue
+		}
+		tags, err := e.extract(ctx, path, injected, content, []tree_sitter.Range{inj.rng})
+		if err != nil {
+			return nil, err
+		}
+		fileTags = append(fileTags, tags...)
+	}
 
+	return fileTags, nil
+}
+
+// matchNameNode returns the node of the `@name` capture of match, which may
+// be spelled `@name.definition.<kind>` as well, if any.
+func matchNameNode(query *tree_sitter.Query, match *tree_sitter.QueryMatch) *tree_sitter.Node {
+	for _, capture := range match.Captures {
+		name := query.CaptureNameForId(capture.Index)
+		if name == "name" || strings.HasPrefix(name, "name.") {
+			return capture.Node
+		}
+	}
 	return nil
 }
 
+// injectionLanguage returns the language named by the
+// `@injection.language` capture of match, if any.
+func injectionLanguage(query *tree_sitter.Query, match *tree_sitter.QueryMatch, content []byte) string {
+	for _, capture := range match.Captures {
+		if query.CaptureNameForId(capture.Index) == "injection.language" {
+			return capture.Node.Content(content)
+		}
+	}
+	return ""
+}
+
+// nodeRange returns the source range node spans.
+func nodeRange(node *tree_sitter.Node) tree_sitter.Range {
+	return tree_sitter.Range{
+		StartPoint: node.StartPoint(),
+		EndPoint:   node.EndPoint(),
+		StartByte:  node.StartByte(),
+		EndByte:    node.EndByte(),
+	}
+}
+
+// captureName returns the name a captured node stands for, without the
+// quotes of a string literal or the colon of a Ruby symbol.
+func captureName(node *tree_sitter.Node, content []byte) string {
+	name := node.Content(content)
+	if node.Type() == "simple_symbol" {
+		return strings.TrimPrefix(name, ":")
+	}
+	if len(name) >= 2 && strings.ContainsAny(name[:1], "\"'`") && name[len(name)-1] == name[0] {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+// relPath makes path relative to the index path
+func (ti *TagIndex) relPath(path string) string {
+	relPath, err := filepath.Rel(ti.Path, path)
+	if err != nil {
+		return path
+	}
+	return relPath
+}
+
+// AddFileEdge records that file from depends on file to.
+func (ti *TagIndex) AddFileEdge(from, to string) {
+	if from == to {
+		return
+	}
+	if _, ok := ti.FileEdges[from]; !ok {
+		ti.FileEdges[from] = make(map[string]struct{})
+	}
+	ti.FileEdges[from][to] = struct{}{}
+}
+
+// addFileTags adds the tags extracted from a single file, rewriting bare
+// references to the qualified names the file imports, so that `User` in a
+// file importing `com.acme.models.User` refers to that class only.
+func (ti *TagIndex) addFileTags(tags []Tag, relPath string) {
+	imported := make(map[string]string)
+	for _, tag := range tags {
+		if tag.Kind != Reference {
+			continue
+		}
+		short := shortName(tag.Name)
+		if short == tag.Name {
+			continue
+		}
+		if prev, ok := imported[short]; ok && prev != tag.Name {
+			// Ambiguous within the file, leave bare references alone
+			imported[short] = ""
+			continue
+		}
+		imported[short] = tag.Name
+	}
+
+	for _, tag := range tags {
+		if tag.Kind == Reference {
+			if qualified := imported[tag.Name]; qualified != "" {
+				tag.Name = qualified
+			}
+		}
+		ti.AddTag(tag, relPath)
+	}
+}
+
 func (ti *TagIndex) AddTag(tag Tag, relPath string) {
 	switch tag.Kind {
 	case Definition:
@@ -225,6 +495,8 @@ func (ti *TagIndex) AddTag(tag Tag, relPath string) {
 
 func (ti *TagIndex) PostProcessTags() {
 	ti.processEmptyReferences()
+	ti.processQualifiedReferences()
+	ti.processSplitDefinitions()
 	ti.processCommonTags()
 }
 
@@ -239,6 +511,63 @@ func (ti *TagIndex) processEmptyReferences() {
 	}
 }
 
+// processQualifiedReferences resolves references that do not name a
+// definition exactly, such as a bare `new` call or a `crate::models::User`
+// import, against qualified definitions sharing the same last segment. A
+// reference is only linked when exactly one definition matches, so that
+// same-named methods on different types stay apart.
+func (ti *TagIndex) processQualifiedReferences() {
+	byShortName := make(map[string][]string)
+	for name := range ti.Defines {
+		short := shortName(name)
+		byShortName[short] = append(byShortName[short], name)
+	}
+
+	// Collect first so that resolved names do not feed back into the loop
+	resolved := make(map[string][]string)
+	for ref, paths := range ti.References {
+		if _, ok := ti.Defines[ref]; ok {
+			continue
+		}
+
+		var match string
+		matches := 0
+		for _, def := range byShortName[shortName(ref)] {
+			if hasQualifiedSuffix(ref, def) || hasQualifiedSuffix(def, ref) {
+				match = def
+				matches++
+			}
+		}
+		if matches == 1 {
+			resolved[match] = append(resolved[match], paths...)
+		}
+	}
+
+	for def, paths := range resolved {
+		ti.References[def] = append(ti.References[def], paths...)
+	}
+}
+
+// processSplitDefinitions links the files of a qualified definition that is
+// spread across several files, such as a C# `partial class` or a Rust type
+// with `impl` blocks in different modules, so that they rank as one logical
+// type. Only the types of languages that split them this way take part;
+// namespaces, and elsewhere any qualified name, are shared by unrelated
+// files.
+func (ti *TagIndex) processSplitDefinitions() {
+	for name := range ti.splitTypes {
+		paths := ti.Defines[name]
+		if len(paths) < 2 {
+			continue
+		}
+		for from := range paths {
+			for to := range paths {
+				ti.AddFileEdge(from, to)
+			}
+		}
+	}
+}
+
 func (ti *TagIndex) processCommonTags() {
 	for key := range ti.Defines {
 		if _, ok := ti.References[key]; ok {
@@ -6,88 +6,11 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	tree_sitter "github.com/smacker/go-tree-sitter"
-	"github.com/smacker/go-tree-sitter/bash"
-	"github.com/smacker/go-tree-sitter/c"
-	"github.com/smacker/go-tree-sitter/cpp"
-	"github.com/smacker/go-tree-sitter/csharp"
-	"github.com/smacker/go-tree-sitter/css"
-	"github.com/smacker/go-tree-sitter/dockerfile"
-	"github.com/smacker/go-tree-sitter/elixir"
-	"github.com/smacker/go-tree-sitter/elm"
-	"github.com/smacker/go-tree-sitter/golang"
-	"github.com/smacker/go-tree-sitter/groovy"
-	"github.com/smacker/go-tree-sitter/hcl"
-	"github.com/smacker/go-tree-sitter/html"
-	"github.com/smacker/go-tree-sitter/java"
-	"github.com/smacker/go-tree-sitter/javascript"
-	"github.com/smacker/go-tree-sitter/kotlin"
-	"github.com/smacker/go-tree-sitter/ocaml"
-	"github.com/smacker/go-tree-sitter/php"
-	"github.com/smacker/go-tree-sitter/protobuf"
-	"github.com/smacker/go-tree-sitter/python"
-	"github.com/smacker/go-tree-sitter/ruby"
-	"github.com/smacker/go-tree-sitter/rust"
-	"github.com/smacker/go-tree-sitter/scala"
-	"github.com/smacker/go-tree-sitter/sql"
-	"github.com/smacker/go-tree-sitter/svelte"
-	"github.com/smacker/go-tree-sitter/swift"
-	"github.com/smacker/go-tree-sitter/toml"
-	"github.com/smacker/go-tree-sitter/typescript/typescript"
-	"github.com/smacker/go-tree-sitter/yaml"
 )
 
-var tsLanguages map[string]*tree_sitter.Language
-
-func init() {
-	tsLanguages = make(map[string]*tree_sitter.Language)
-
-	// Initialize all supported languages
-	tsLanguages["bash"] = bash.GetLanguage()
-	tsLanguages["c"] = c.GetLanguage()
-	tsLanguages["cpp"] = cpp.GetLanguage()
-	tsLanguages["cs"] = csharp.GetLanguage()
-	tsLanguages["csharp"] = csharp.GetLanguage()
-	tsLanguages["css"] = css.GetLanguage()
-	tsLanguages["dockerfile"] = dockerfile.GetLanguage()
-	tsLanguages["elixir"] = elixir.GetLanguage()
-	tsLanguages["elm"] = elm.GetLanguage()
-	tsLanguages["go"] = golang.GetLanguage()
-	tsLanguages["golang"] = golang.GetLanguage()
-	tsLanguages["groovy"] = groovy.GetLanguage()
-	tsLanguages["hcl"] = hcl.GetLanguage()
-	tsLanguages["html"] = html.GetLanguage()
-	tsLanguages["java"] = java.GetLanguage()
-	tsLanguages["javascript"] = javascript.GetLanguage()
-	tsLanguages["js"] = javascript.GetLanguage()
-	tsLanguages["kt"] = kotlin.GetLanguage()
-	tsLanguages["kotlin"] = kotlin.GetLanguage()
-	tsLanguages["ml"] = ocaml.GetLanguage()
-	tsLanguages["ocaml"] = ocaml.GetLanguage()
-	tsLanguages["php"] = php.GetLanguage()
-	tsLanguages["proto"] = protobuf.GetLanguage()
-	tsLanguages["protobuf"] = protobuf.GetLanguage()
-	tsLanguages["py"] = python.GetLanguage()
-	tsLanguages["python"] = python.GetLanguage()
-	tsLanguages["rb"] = ruby.GetLanguage()
-	tsLanguages["ruby"] = ruby.GetLanguage()
-	tsLanguages["rs"] = rust.GetLanguage()
-	tsLanguages["rust"] = rust.GetLanguage()
-	tsLanguages["scala"] = scala.GetLanguage()
-	tsLanguages["sql"] = sql.GetLanguage()
-	tsLanguages["svelte"] = svelte.GetLanguage()
-	tsLanguages["swift"] = swift.GetLanguage()
-	tsLanguages["toml"] = toml.GetLanguage()
-	tsLanguages["ts"] = typescript.GetLanguage()
-	tsLanguages["tsx"] = typescript.GetLanguage()
-	tsLanguages["typescript"] = typescript.GetLanguage()
-	tsLanguages["yaml"] = yaml.GetLanguage()
-	tsLanguages["yml"] = yaml.GetLanguage()
-}
-
 const REPOMAP_DEFAULT_TOKENS = 1024
 
 type RepoMap struct {
@@ -275,13 +198,13 @@ func (rm *RepoMap) renderTree(absFname string, fileContent []byte, lois []int) s
 		code += "\n"
 	}
 
-	parser := tree_sitter.NewParser()
-	ext := strings.ToLower(strings.TrimPrefix(strings.ToLower(filepath.Ext(absFname)), "."))
-	if lang, ok := tsLanguages[ext]; ok {
-		parser.SetLanguage(lang)
-	} else {
-		parser.SetLanguage(tsLanguages["javascript"]) // fallback
+	// Files that cannot be classified are not rendered rather than misparsed
+	lang := newDiskLanguageDetector(absFname).detect(absFname, fileContent)
+	if lang == nil {
+		return ""
 	}
+	parser := tree_sitter.NewParser()
+	parser.SetLanguage(lang.grammar)
 
 	tree, err := parser.ParseCtx(context.Background(), nil, []byte(code))
 	if err != nil {